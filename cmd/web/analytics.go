@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"snippety/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// visitorHasher turns a client IP and user agent into an opaque visitor id
+// for counting uniques. The salt is random, held only in memory and
+// replaced every UTC day, so ids can't be reversed or linked across days.
+// A restart also replaces it, which can count a visitor twice that day.
+type visitorHasher struct {
+	mu   sync.Mutex
+	day  time.Time
+	salt [16]byte
+}
+
+func (h *visitorHasher) hash(ip, userAgent string) string {
+	h.mu.Lock()
+	if today := time.Now().UTC().Truncate(24 * time.Hour); !today.Equal(h.day) {
+		h.day = today
+		rand.Read(h.salt[:])
+	}
+	salt := h.salt
+	h.mu.Unlock()
+
+	sum := sha256.New()
+	sum.Write(salt[:])
+	sum.Write([]byte(ip))
+	sum.Write([]byte{0})
+	sum.Write([]byte(userAgent))
+	return hex.EncodeToString(sum.Sum(nil)[:16])
+}
+
+// Paths never counted as page views.
+var untrackedPrefixes = []string{"/static/", "/api/", "/admin", "/metrics", "/healthz"}
+
+// pageViewBuffer counts page views in memory until the next flush, so
+// serving a page never waits on the database.
+type pageViewBuffer struct {
+	mu      sync.Mutex
+	tallies map[pageViewKey]int
+	dropped int
+}
+
+type pageViewKey struct {
+	day     time.Time
+	path    string
+	visitor string
+}
+
+// Most distinct day, path and visitor combinations held between flushes.
+// Views beyond it are dropped, so an outage can't grow the buffer without
+// bound.
+const maxBufferedPageViews = 10000
+
+// How often buffered page views are written out.
+const pageViewFlushInterval = 30 * time.Second
+
+func (b *pageViewBuffer) add(key pageViewKey, views int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tallies == nil {
+		b.tallies = map[pageViewKey]int{}
+	}
+	if _, ok := b.tallies[key]; !ok && len(b.tallies) >= maxBufferedPageViews {
+		b.dropped += views
+		return
+	}
+	b.tallies[key] += views
+}
+
+// Take everything counted so far, and how many views were dropped.
+func (b *pageViewBuffer) take() ([]models.PageViewTally, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tallies := make([]models.PageViewTally, 0, len(b.tallies))
+	for k, n := range b.tallies {
+		tallies = append(tallies, models.PageViewTally{Day: k.day, Path: k.path, Visitor: k.visitor, Views: n})
+	}
+	dropped := b.dropped
+	b.tallies, b.dropped = nil, 0
+	return tallies, dropped
+}
+
+// Write buffered page views out every interval. Nothing is written while
+// read-only mode is on; views are held, up to the buffer's limit, until
+// it's turned off.
+func (app *application) flushPageViews(interval time.Duration) {
+	for range time.Tick(interval) {
+		if app.readOnly.Load() {
+			continue
+		}
+		err := app.flushPageViewsOnce()
+		if err != nil && !errors.Is(err, models.ErrUnavailable) {
+			app.logger.Error("recording page views failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Write buffered page views out now. Those that weren't written are kept
+// for the next flush; those that were aren't, so none is counted twice.
+func (app *application) flushPageViewsOnce() error {
+	tallies, dropped := app.pageViewBuffer.take()
+	if dropped > 0 {
+		app.logger.Warn("page views dropped, buffer full", slog.Int("views", dropped))
+	}
+	if len(tallies) == 0 {
+		return nil
+	}
+
+	added, err := app.pageViews.Add(tallies)
+	if err != nil {
+		for _, t := range tallies[added:] {
+			app.pageViewBuffer.add(pageViewKey{t.Day, t.Path, t.Visitor}, t.Views)
+		}
+	}
+	return err
+}
+
+// countPageViews counts successful GET requests for pages while analytics
+// is on. No cookies are set and no IPs are stored.
+func (app *application) countPageViews(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.analytics.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		if r.Method != http.MethodGet || sw.status != http.StatusOK {
+			return
+		}
+		for _, prefix := range untrackedPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return
+			}
+		}
+
+		day := time.Now().UTC().Truncate(24 * time.Hour)
+		visitor := app.visitors.hash(clientIP(r), r.UserAgent())
+		app.pageViewBuffer.add(pageViewKey{day, r.URL.Path, visitor}, 1)
+	})
+}
+
+// Range and length of the admin analytics report.
+const (
+	pageViewReportDays  = 30
+	pageViewReportPaths = 50
+)
+
+func (app *application) adminAnalytics(w http.ResponseWriter, r *http.Request) {
+	views, err := app.pageViews.Report(pageViewReportDays, pageViewReportPaths)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.PageViews = views
+
+	app.render(w, r, http.StatusOK, "analytics.tmpl.html", data)
+}
+
+// Number of events on the activity page.
+const activityEvents = 100
+
+// Show the latest snippet activity across the site.
+func (app *application) adminActivity(w http.ResponseWriter, r *http.Request) {
+	events, err := app.events.Recent(activityEvents)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	deadJobs, err := app.jobs.Store.DeadJobs(deadJobsShown)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Events = events
+	data.DeadJobs = deadJobs
+
+	app.render(w, r, http.StatusOK, "activity.tmpl.html", data)
+}
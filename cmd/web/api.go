@@ -0,0 +1,596 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"snippety/internal/format"
+	"snippety/internal/hooks"
+	"snippety/internal/models"
+	"snippety/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiSnippet is the JSON representation of a snippet. List responses carry
+// only the excerpt; content and the word count are omitted there.
+type apiSnippet struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content,omitempty"`
+	Language string    `json:"language,omitempty"`
+	Excerpt  string    `json:"excerpt"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	// Whole seconds until Expires, so clients needn't trust their own clock.
+	ExpiresIn int64           `json:"expires_in"`
+	PublishAt time.Time       `json:"publish_at"`
+	Version   int             `json:"version"`
+	Updated   time.Time       `json:"updated"`
+	Metadata  models.Metadata `json:"metadata,omitempty"`
+	Stats     apiSnippetStats `json:"stats"`
+}
+
+type apiSnippetStats struct {
+	Lines int `json:"lines"`
+	Words int `json:"words"`
+	Bytes int `json:"bytes"`
+}
+
+func toAPISnippet(s models.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:        s.ID,
+		Title:     s.Title,
+		Content:   s.Content,
+		Language:  s.Language,
+		Excerpt:   s.Excerpt,
+		Created:   s.Created,
+		Expires:   s.Expires,
+		ExpiresIn: int64(s.ExpiresIn() / time.Second),
+		PublishAt: s.PublishAt,
+		Version:   s.Version,
+		Updated:   s.Updated,
+		Metadata:  s.Metadata,
+		Stats:     apiSnippetStats{Lines: s.Lines, Words: s.Words, Bytes: s.Bytes},
+	}
+}
+
+func toAPISnippets(snippets []models.Snippet) []apiSnippet {
+	out := make([]apiSnippet, len(snippets))
+	for i, s := range snippets {
+		out[i] = toAPISnippet(s)
+	}
+	return out
+}
+
+// Machine-readable codes used in API error responses. Clients should
+// branch on these rather than on messages, which may be reworded.
+const (
+	codeBadRequest       = "bad_request"        // 400: the body or query could not be understood
+	codeUnauthorized     = "unauthorized"       // 401: missing or wrong admin credentials
+	codeNotFound         = "not_found"          // 404: no such resource (or it has expired)
+	codeMethodNotAllowed = "method_not_allowed" // 405: the resource exists but not with this method; see Allow
+	codeConflict         = "conflict"           // 409: the resource already exists
+	codeEditConflict     = "edit_conflict"      // 409: the resource changed since the given version; see current
+	codeTooLarge         = "too_large"          // 413: a value is too long to store
+	codeValidationFailed = "validation_failed"  // 422: see fields for per-field messages
+	codeUnformattable    = "unformattable"      // 422: the content doesn't parse as its language
+	codeRateLimited      = "rate_limited"       // 429: slow down and retry later
+	codeUnavailable      = "unavailable"        // 503: maintenance or database outage; see Retry-After
+	codeReadOnly         = "read_only"          // 503: writes are disabled for now; reads still work
+	codeInternal         = "internal_error"     // 500: a server-side bug or failure
+)
+
+// Every API error is sent as {"error": apiErrorBody}.
+type apiErrorBody struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	// The resource as it is now, sent with edit_conflict so the client
+	// can merge and retry without another request.
+	Current any `json:"current,omitempty"`
+}
+
+// Send a JSON error response. message is shown to the client as-is.
+func (app *application) apiError(w http.ResponseWriter, r *http.Request, status int, code, message string, fields map[string]string) {
+	body := map[string]any{"error": apiErrorBody{Code: code, Message: message, Fields: fields}}
+
+	err := app.writeJSON(w, status, body, nil)
+	if err != nil {
+		app.logger.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (app *application) apiBadRequest(w http.ResponseWriter, r *http.Request, message string) {
+	app.apiError(w, r, http.StatusBadRequest, codeBadRequest, message, nil)
+}
+
+func (app *application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, r, http.StatusNotFound, codeNotFound, "the requested resource could not be found", nil)
+}
+
+func (app *application) apiMethodNotAllowed(w http.ResponseWriter, r *http.Request, allow []string) {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	app.apiError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method), nil)
+}
+
+func (app *application) apiFailedValidation(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	app.apiError(w, r, http.StatusUnprocessableEntity, codeValidationFailed, "the request contains invalid fields", fields)
+}
+
+func (app *application) apiUnavailable(w http.ResponseWriter, r *http.Request, retryAfter int) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	app.apiError(w, r, http.StatusServiceUnavailable, codeUnavailable, "the service is temporarily unavailable, please retry later", nil)
+}
+
+// Respond to an update based on an old version with the current one.
+func (app *application) apiEditConflict(w http.ResponseWriter, r *http.Request, id int) {
+	snippet, err := app.snippets.GetLatest(id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	body := apiErrorBody{
+		Code:    codeEditConflict,
+		Message: "the snippet was changed by someone else; merge with current and retry with its version",
+		Current: toAPISnippet(snippet),
+	}
+	err = app.writeJSON(w, http.StatusConflict, map[string]any{"error": body}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// Like serverError, model errors caused by the request get a 4xx response.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrUnavailable):
+		app.apiUnavailable(w, r, int(app.breaker.Cooldown.Seconds()))
+		return
+	case errors.Is(err, models.ErrNoRecord):
+		app.apiNotFound(w, r)
+		return
+	case errors.Is(err, models.ErrDuplicate):
+		app.apiError(w, r, http.StatusConflict, codeConflict, "the resource already exists", nil)
+		return
+	case errors.Is(err, models.ErrEditConflict):
+		app.apiError(w, r, http.StatusConflict, codeEditConflict, "the resource was changed by someone else", nil)
+		return
+	case errors.Is(err, models.ErrTooLong):
+		app.apiError(w, r, http.StatusRequestEntityTooLarge, codeTooLarge, "a submitted value is too long to store", nil)
+		return
+	}
+
+	app.logger.Error(err.Error(), "method", r.Method, "uri", loggedURI(r))
+	app.reportError(r, err)
+	app.apiError(w, r, http.StatusInternalServerError, codeInternal, "the server encountered a problem and could not process your request", nil)
+}
+
+// Paging details sent with list responses so clients can render pagers.
+// Cursor-paged responses have no page numbers.
+type apiListMetadata struct {
+	TotalRecords int `json:"total_records"`
+	PageSize     int `json:"page_size"`
+	CurrentPage  int `json:"current_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+}
+
+// List snippets, or search them when q is given using the same query
+// syntax as the search page. Without q, limit, offset, cursor and sort
+// page through the listing; next_cursor is set when another page may follow.
+// metadata carries the total count, and page numbers when paging by offset.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	if qs.Has("updated_since") {
+		app.apiSnippetChanges(w, r)
+		return
+	}
+
+	if q := qs.Get("q"); q != "" {
+		filter, err := models.ParseQuery(q)
+		if err != nil {
+			app.apiBadRequest(w, r, strings.TrimPrefix(err.Error(), "models: "))
+			return
+		}
+
+		snippets, err := app.search.Search(filter)
+		if err != nil {
+			app.apiServerError(w, r, err)
+			return
+		}
+
+		body := map[string]any{
+			"snippets": toAPISnippets(snippets),
+			"metadata": apiListMetadata{TotalRecords: len(snippets), PageSize: len(snippets), CurrentPage: 1, LastPage: 1},
+		}
+		err = app.writeJSON(w, http.StatusOK, body, nil)
+		if err != nil {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	opts := models.SnippetListOptions{Sort: models.SnippetSort(qs.Get("sort"))}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &opts.Limit}, {"offset", &opts.Offset}, {"cursor", &opts.Cursor}} {
+		v := qs.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			app.apiBadRequest(w, r, fmt.Sprintf("%s must be a non-negative integer", p.name))
+			return
+		}
+		*p.dst = n
+	}
+
+	snippets, err := app.snippets.List(opts)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidListOptions) {
+			app.apiBadRequest(w, r, strings.TrimPrefix(err.Error(), "models: invalid list options: "))
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	body := map[string]any{"snippets": toAPISnippets(snippets)}
+	limit := cmp.Or(min(opts.Limit, models.MaxListLimit), models.DefaultListLimit)
+	if len(snippets) == limit && (opts.Sort == "" || opts.Sort == models.SortNewest || opts.Sort == models.SortOldest) {
+		body["next_cursor"] = snippets[len(snippets)-1].ID
+	}
+
+	// The count is left out rather than failing the request when the
+	// listing came from the outage cache.
+	total, err := app.snippets.Count(models.SnippetListOptions{})
+	switch {
+	case err == nil:
+		meta := apiListMetadata{TotalRecords: total, PageSize: limit}
+		if opts.Cursor == 0 {
+			meta.CurrentPage = opts.Offset/limit + 1
+			meta.LastPage = max(1, (total+limit-1)/limit)
+		}
+		body["metadata"] = meta
+	case !errors.Is(err, models.ErrUnavailable):
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, body, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiSnippetView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+	if !app.authorize(r, actionViewSnippet, &snippet) {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"snippet": toAPISnippet(snippet)}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// Return a snippet's content in its language's canonical layout. Snippets
+// without a formatter for their language have no formatted version.
+func (app *application) apiSnippetFormatted(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	if !app.authorize(r, actionViewSnippet, &snippet) || !format.Supported(snippet.Language) {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	formatted, err := format.Format(snippet.Language, snippet.Content)
+	if err != nil {
+		app.apiError(w, r, http.StatusUnprocessableEntity, codeUnformattable, err.Error(), nil)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"language": snippet.Language, "content": formatted}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+type apiDiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Return the line diff from snippet idA to snippet idB. Each line's op is
+// "equal", "delete" or "insert".
+func (app *application) apiSnippetCompare(w http.ResponseWriter, r *http.Request) {
+	var snippets [2]models.Snippet
+	for i, name := range []string{"idA", "idB"} {
+		id, err := strconv.Atoi(r.PathValue(name))
+		if err != nil || id < 1 {
+			app.apiNotFound(w, r)
+			return
+		}
+
+		snippets[i], err = app.visibleSnippet(r, id)
+		if err != nil {
+			app.apiServerError(w, r, err)
+			return
+		}
+	}
+
+	c := newComparison(snippets[0], snippets[1])
+	lines := make([]apiDiffLine, len(c.Lines))
+	for i, l := range c.Lines {
+		lines[i] = apiDiffLine{Op: l.Op.String(), Text: l.Text}
+	}
+
+	body := map[string]any{
+		"a":        c.A.ID,
+		"b":        c.B.ID,
+		"inserted": c.Inserted,
+		"deleted":  c.Deleted,
+		"lines":    lines,
+	}
+	err := app.writeJSON(w, http.StatusOK, body, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+type apiLanguageCount struct {
+	// Empty for plain text.
+	Language string `json:"language"`
+	Count    int    `json:"count"`
+}
+
+// Count live snippets per language, most used first. These are the stats
+// page's numbers, so they're up to a few minutes old.
+func (app *application) apiLanguageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.snippetStats()
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	languages := make([]apiLanguageCount, len(stats.Languages))
+	for i, l := range stats.Languages {
+		languages[i] = apiLanguageCount{Language: l.Language, Count: l.Count}
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"total": stats.Total, "languages": languages}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title     string          `json:"title"`
+		Content   string          `json:"content"`
+		Language  string          `json:"language"`
+		Metadata  models.Metadata `json:"metadata"`
+		Expires   int             `json:"expires"`
+		PublishAt time.Time       `json:"publish_at"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, r, err.Error())
+		return
+	}
+
+	input.Content = app.content.normalize(input.Content)
+
+	var v validator.Validator
+	draft := hooks.Draft{Title: input.Title, Content: input.Content, Language: input.Language}
+	if err := filterDraft(&v, &draft); err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	input.Title, input.Content, input.Language = draft.Title, draft.Content, draft.Language
+
+	if input.Expires == 0 {
+		input.Expires = app.expiry.defaultDays
+	}
+
+	validateSnippet(&v, input.Title, input.Content, input.Language, app.content.maxBytes)
+	validateMetadata(&v, input.Metadata)
+	validateExpiry(&v, input.Expires, app.expiry.choices())
+	if !input.PublishAt.IsZero() {
+		v.CheckField(input.PublishAt.After(time.Now()), "publish_at", "must be in the future")
+		v.CheckField(input.Expires == models.NeverExpires || input.PublishAt.Before(time.Now().AddDate(0, 0, input.Expires)), "publish_at", "must be before the snippet expires")
+	}
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	id, err := app.snippets.Insert(input.Title, input.Content, input.Language, input.Metadata, input.Expires, app.expiry.policy, input.PublishAt)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.snippetCreated(id, input.Title, input.PublishAt)
+
+	snippet, err := app.snippets.GetLatest(id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", app.absoluteURL(r, fmt.Sprintf("/api/v1/snippets/%d", id)))
+
+	err = app.writeJSON(w, http.StatusCreated, map[string]any{"snippet": toAPISnippet(snippet)}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// Change some of a snippet's fields. Fields left out of the body keep
+// their value, so clients can change just the title or the expiry without
+// resending the content. The request must include the version it's based
+// on; if the snippet has changed since, the response is a 409 carrying the
+// current snippet.
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	var input struct {
+		Title    *string          `json:"title"`
+		Content  *string          `json:"content"`
+		Language *string          `json:"language"`
+		Metadata *models.Metadata `json:"metadata"`
+		Expires  *int             `json:"expires"`
+		Version  *int             `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, r, err.Error())
+		return
+	}
+
+	if input.Content != nil {
+		*input.Content = app.content.normalize(*input.Content)
+	}
+
+	var v validator.Validator
+	if hooks.Filtering() && (input.Title != nil || input.Content != nil || input.Language != nil) {
+		filtered := models.SnippetUpdate{Title: input.Title, Content: input.Content, Language: input.Language}
+		err = app.filterUpdate(&v, id, &filtered)
+		input.Title, input.Content, input.Language = filtered.Title, filtered.Content, filtered.Language
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+			return
+		}
+		if err != nil {
+			app.apiServerError(w, r, err)
+			return
+		}
+	}
+	if input.Title != nil {
+		validateTitle(&v, *input.Title)
+	}
+	if input.Content != nil {
+		validateContent(&v, *input.Content, app.content.maxBytes)
+	}
+	if input.Language != nil {
+		validateLanguage(&v, *input.Language)
+	}
+	if input.Metadata != nil {
+		validateMetadata(&v, *input.Metadata)
+	}
+	v.CheckField(input.Title != nil || input.Content != nil || input.Language != nil || input.Metadata != nil || input.Expires != nil,
+		"body", "must change at least one of title, content, language, metadata or expires")
+	v.CheckField(input.Version != nil, "version", "must be provided")
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	update := models.SnippetUpdate{Title: input.Title, Content: input.Content, Language: input.Language, Expires: input.Expires, Metadata: input.Metadata}
+	err = app.snippets.Update(id, update, app.expiry.policy, *input.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.apiNotFound(w, r)
+		case errors.Is(err, models.ErrEditConflict):
+			app.apiEditConflict(w, r, id)
+		case errors.Is(err, models.ErrInvalidExpiry):
+			app.apiFailedValidation(w, r, map[string]string{"expires": strings.TrimPrefix(err.Error(), "models: invalid expiry: ")})
+		default:
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	snippet, err := app.snippets.GetLatest(id)
+	if err != nil {
+		app.snippetUpdated(id, "")
+		app.apiServerError(w, r, err)
+		return
+	}
+	app.snippetUpdated(id, snippet.Title)
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"snippet": toAPISnippet(snippet)}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// Run the save filters on an edit. Filters see the whole snippet, so
+// fields the edit leaves out are filled in from the stored one; any a
+// filter changes become part of the edit.
+func (app *application) filterUpdate(v *validator.Validator, id int, u *models.SnippetUpdate) error {
+	current, err := app.snippets.GetLatest(id)
+	if err != nil {
+		return err
+	}
+
+	draft := hooks.Draft{Title: current.Title, Content: current.Content, Language: current.Language}
+	if u.Title != nil {
+		draft.Title = *u.Title
+	}
+	if u.Content != nil {
+		draft.Content = *u.Content
+	}
+	if u.Language != nil {
+		draft.Language = *u.Language
+	}
+
+	if err := filterDraft(v, &draft); err != nil {
+		return err
+	}
+
+	if u.Title != nil || draft.Title != current.Title {
+		u.Title = &draft.Title
+	}
+	if u.Content != nil || draft.Content != current.Content {
+		u.Content = &draft.Content
+	}
+	if u.Language != nil || draft.Language != current.Language {
+		u.Language = &draft.Language
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// What happens to snippets once they expire, chosen with -expiry-mode.
+// Either way they can be restored by giving them a new expiry, until
+// -purge-after deletes them for good.
+const (
+	// Expired snippets disappear; their page says only that they expired.
+	expiryHide = "hide"
+	// Expired snippets are archived: their owner can still read them.
+	expiryArchive = "archive"
+)
+
+func parseExpiryMode(s string) (bool, error) {
+	switch s {
+	case expiryHide:
+		return false, nil
+	case expiryArchive:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown expiry mode %q (want %s or %s)", s, expiryHide, expiryArchive)
+}
+
+// How often expired snippets past the purge horizon are looked for.
+const purgeInterval = time.Hour
+
+// Delete snippets that expired more than -purge-after ago. It runs as a
+// recurring job, so one server does it each time however many there are,
+// and does nothing while the site is read-only.
+func (app *application) purgeExpiredJob(ctx context.Context, _ []byte) error {
+	if app.readOnly.Load() {
+		return nil
+	}
+
+	ids, err := app.snippets.PurgeExpired(time.Now().Add(-app.purgeAfter))
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for _, id := range ids {
+		if err := app.search.Delete(id); err != nil {
+			app.logger.Error("removing purged snippet from search failed", slog.Int("id", id), slog.String("error", err.Error()))
+		}
+	}
+	app.logger.Info("purged expired snippets", slog.Int("count", len(ids)), slog.Duration("expired_for", app.purgeAfter))
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// assets maps static files to fingerprinted URLs containing a hash of
+// their content, such as /static/css/main.3f2a9c1b.css. A changed file gets
+// a new URL, so fingerprinted responses can be cached forever.
+type assets struct {
+	dir string
+	// css/main.css -> /static/css/main.3f2a9c1b.css
+	urls map[string]string
+	// css/main.3f2a9c1b.css -> css/main.css
+	files map[string]string
+}
+
+// Hash every file under dir. Files added or changed afterwards keep their
+// old fingerprint until restart.
+func newAssets(dir string) (*assets, error) {
+	a := &assets{dir: dir, urls: map[string]string{}, files: map[string]string{}}
+
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+
+		ext := path.Ext(name)
+		fingerprinted := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+
+		a.urls[name] = "/static/" + fingerprinted
+		a.files[fingerprinted] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Return the fingerprinted URL for a file, for use in templates as
+// {{asset "css/main.css"}}.
+func (a *assets) url(name string) (string, error) {
+	u, ok := a.urls[name]
+	if !ok {
+		return "", fmt.Errorf("unknown asset %q", name)
+	}
+	return u, nil
+}
+
+// Serve files from the static directory. Fingerprinted names are mapped
+// back to the real file and marked immutable; plain names are served as
+// before with default caching.
+func (a *assets) handler() http.Handler {
+	fileServer := http.FileServer(http.Dir(a.dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := a.files[strings.TrimPrefix(r.URL.Path, "/")]; ok {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			r = r.Clone(r.Context())
+			r.URL.Path = "/" + name
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"snippety/internal/models"
+)
+
+// role is what a requester may do across the site. Roles are ordered:
+// each can do everything the ones below it can.
+type role int
+
+const (
+	roleViewer role = iota + 1
+	// Holders of a quick save token: viewers who may also create
+	// snippets through the quick save endpoint.
+	roleWriter
+	roleAdmin
+)
+
+// action is something a handler needs permission for.
+type action string
+
+const (
+	actionViewSnippet       action = "snippet:view"
+	actionViewUnpublished   action = "snippet:view-unpublished"
+	actionViewArchived      action = "snippet:view-archived"
+	actionQuickSave         action = "snippet:quick-save"
+	actionManageSite        action = "site:manage"
+	actionBypassMaintenance action = "site:bypass-maintenance"
+)
+
+// The least role allowed to take each action. Actions missing here are
+// denied to everyone.
+var permissions = map[action]role{
+	actionViewSnippet:       roleViewer,
+	actionViewUnpublished:   roleAdmin,
+	actionViewArchived:      roleAdmin,
+	actionQuickSave:         roleWriter,
+	actionManageSite:        roleAdmin,
+	actionBypassMaintenance: roleAdmin,
+}
+
+// Return the requester's role. Without user accounts, admin credentials
+// and quick save tokens are the only things that raise it above viewer.
+func (app *application) role(r *http.Request) role {
+	switch {
+	case app.isAdmin(r):
+		return roleAdmin
+	case app.hasQuickSaveToken(r):
+		return roleWriter
+	}
+	return roleViewer
+}
+
+// Report whether the requester may take act, on snippet if the action is
+// about one. This is the single place permissions are decided; handlers
+// and middleware shouldn't check roles themselves.
+func (app *application) authorize(r *http.Request, act action, snippet *models.Snippet) bool {
+	// Viewing a scheduled snippet before it's published is a separate
+	// permission.
+	if act == actionViewSnippet && snippet != nil && !snippet.Published() {
+		act = actionViewUnpublished
+	}
+
+	least, ok := permissions[act]
+	return ok && app.role(r) >= least
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The create form carries two traps for bots. The honeypot is a field
+// hidden from people with CSS, so anything typed into it came from a
+// script filling in every input. The started field records when the form
+// was rendered, signed with -form-secret so it can't be forged. A
+// submission that comes back sooner than -form-min-time wasn't typed, and
+// one later than -form-max-age is refused so a form fetched once can't be
+// replayed by a script for ever after. A missing, forged or stale start
+// time is as likely to be a person with an old tab or a rotated secret as
+// a bot, so those submissions get the form back to send again.
+const (
+	honeypotField = "website"
+	startedField  = "started"
+)
+
+func (app *application) formSignature(started int64) string {
+	mac := hmac.New(sha256.New, app.formSecret)
+	fmt.Fprintf(mac, "form:%d", started)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// A value for the started field, recording now.
+func (app *application) formStarted() string {
+	now := time.Now().UnixMilli()
+	return strconv.FormatInt(now, 10) + "." + app.formSignature(now)
+}
+
+// Report why a submitted form can't be accepted, or "" if it can. retry
+// is true when the submitter should be shown the form again rather than
+// refused as a bot. Call after ParseForm.
+func (app *application) botCheck(r *http.Request) (reason string, retry bool) {
+	if r.PostForm.Get(honeypotField) != "" {
+		return "honeypot filled in", false
+	}
+
+	ts, sig, _ := strings.Cut(r.PostForm.Get(startedField), ".")
+	started, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(app.formSignature(started))) {
+		return "missing or forged start time", true
+	}
+	elapsed := time.Since(time.UnixMilli(started))
+	switch {
+	case elapsed < app.formMinTime:
+		return fmt.Sprintf("submitted %s after the form was shown", elapsed.Round(time.Millisecond)), false
+	case elapsed > app.formMaxAge:
+		return fmt.Sprintf("form shown %s ago has gone stale", elapsed.Round(time.Second)), true
+	}
+	return "", false
+}
+
+// Log and refuse a submission botCheck flagged.
+func (app *application) rejectBot(w http.ResponseWriter, r *http.Request, reason string) {
+	app.logger.Warn("rejected bot submission",
+		slog.String("ip", clientIP(r)),
+		slog.String("uri", loggedURI(r)),
+		slog.String("reason", reason),
+	)
+	app.clientError(w, http.StatusBadRequest)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// How long -check-config waits for each database to answer.
+const checkConfigTimeout = 5 * time.Second
+
+// Print the effective configuration with secrets redacted, then check
+// that the server could start with it: values pass validateFlags, the
+// database answers, directories are writable and the address is free.
+// Returns the exit status, which is non-zero if any check failed.
+func checkConfig(w io.Writer) int {
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(w, "%s = %s\n", f.Name, redactFlag(f.Name, f.Value.String()))
+	})
+	fmt.Fprintln(w)
+
+	value := func(name string) string {
+		return flag.Lookup(name).Value.String()
+	}
+
+	_, problems := validateFlags()
+	check := func(name string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("-%s: %s", name, err))
+		}
+	}
+
+	switch value("storage") {
+	case "mysql":
+		opts := dbOptions{tls: value("db-tls"), caFile: value("db-ca")}
+		sockets := map[string]string{"dsn": value("db-socket"), "read-dsn": value("read-db-socket")}
+		for _, name := range []string{"dsn", "read-dsn"} {
+			if value(name) == "" {
+				continue
+			}
+			cfg, err := opts.config(name, value(name), sockets[name])
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			check(name, pingDB(cfg))
+		}
+	case "file":
+		check("data-dir", checkWritableDir(value("data-dir")))
+	}
+
+	if value("search") == "embedded" {
+		check("search-index", checkWritableDir(filepath.Dir(value("search-index"))))
+	}
+
+	if path := value("log-file"); path != "" {
+		check("log-file", checkWritableDir(filepath.Dir(path)))
+	}
+	if path := value("access-log"); path != "" && path != "-" {
+		check("access-log", checkWritableDir(filepath.Dir(path)))
+	}
+
+	l, err := net.Listen("tcp", value("addr"))
+	if err == nil {
+		l.Close()
+	}
+	check("addr", err)
+
+	staticAssets, err := newAssets("./ui/static")
+	if err == nil {
+		_, err = newTemplateCache(staticAssets, value("theme-dir"))
+	}
+	if err != nil {
+		problems = append(problems, "templates: "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(w, "FAIL", p)
+		}
+		return 1
+	}
+	fmt.Fprintln(w, "OK")
+	return 0
+}
+
+// Hide a secret flag's value, keeping enough of a DSN or URL to show
+// where it points.
+func redactFlag(name, value string) string {
+	if !secretFlags[name] || value == "" {
+		return value
+	}
+
+	switch name {
+	case "dsn", "read-dsn":
+		cfg, err := mysql.ParseDSN(value)
+		if err != nil {
+			break
+		}
+		if cfg.Passwd != "" {
+			cfg.Passwd = "REDACTED"
+		}
+		return cfg.FormatDSN()
+	case "sentry-dsn", "error-webhook", "alert-webhook":
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			break
+		}
+		return u.Scheme + "://" + u.Host + "/REDACTED"
+	}
+	return "REDACTED"
+}
+
+func pingDB(cfg *mysql.Config) error {
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return err
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkConfigTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// Check that dir exists and a file can be created in it.
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".check-config-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
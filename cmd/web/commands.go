@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"snippety/internal/backup"
+	"snippety/internal/models"
+	"snippety/internal/search"
+	"snippety/internal/seed"
+	"time"
+)
+
+// Run a one-off command given after the global flags, for example:
+//
+//	web -dsn=... backup -o backup.tar.gz
+func (app *application) runCommand(name string, args []string) error {
+	switch name {
+	case "reindex":
+		return app.rebuildCommand([]string{rebuildSearch})
+	case "rebuild":
+		return app.rebuildCommand(args)
+	case "backup":
+		return app.backupCommand(args)
+	case "restore":
+		return app.restoreCommand(args)
+	case "seed":
+		return app.seedCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func (app *application) backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("o", "backup.tar.gz", "Output archive path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		contents backup.Contents
+		err      error
+	)
+	if contents.Snippets, err = app.snippets.Export(); err != nil {
+		return err
+	}
+	if contents.Templates, err = app.snippetTemplates.All(); err != nil {
+		return err
+	}
+	if contents.Banners, err = app.banners.All(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+
+	err = backup.Write(f, contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	app.logger.Info("wrote backup", "path", *out, "snippets", len(contents.Snippets), "templates", len(contents.Templates), "banners", len(contents.Banners))
+	return nil
+}
+
+func (app *application) restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("i", "backup.tar.gz", "Input archive path")
+	dryRun := fs.Bool("dry-run", false, "Report what would change without writing anything")
+	overwrite := fs.Bool("overwrite", false, "Replace existing snippets that differ from the archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, contents, err := backup.Read(f)
+	if err != nil {
+		return err
+	}
+
+	report, err := app.snippets.Restore(contents.Snippets, *overwrite, *dryRun)
+	if err != nil {
+		return err
+	}
+	if err := app.restoreTemplates(contents.Templates, *overwrite, *dryRun); err != nil {
+		return err
+	}
+	if err := app.restoreBanners(contents.Banners, *dryRun); err != nil {
+		return err
+	}
+
+	app.logger.Info("restored backup",
+		"path", *in,
+		"archived", manifest.Created,
+		"dry_run", *dryRun,
+		"inserted", report.Inserted,
+		"replaced", report.Replaced,
+		"unchanged", report.Unchanged,
+		"conflicts", len(report.Conflicts),
+	)
+	if len(report.Conflicts) > 0 {
+		app.logger.Warn("snippets differ from the archive and were skipped; rerun with -overwrite to replace them", "ids", report.Conflicts)
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	if index, ok := app.search.(search.Rebuilder); ok {
+		return index.Rebuild()
+	}
+	return nil
+}
+
+// Restore templates, matching them to existing ones by name, since ids
+// differ between databases. Like snippets, one that differs from the
+// archive is only replaced with overwrite.
+func (app *application) restoreTemplates(templates []models.SnippetTemplate, overwrite, dryRun bool) error {
+	existing, err := app.snippetTemplates.All()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]models.SnippetTemplate, len(existing))
+	for _, t := range existing {
+		byName[t.Name] = t
+	}
+
+	var inserted, replaced, conflicts []string
+	for _, t := range templates {
+		current, ok := byName[t.Name]
+		switch {
+		case !ok:
+			inserted = append(inserted, t.Name)
+			if !dryRun {
+				_, err = app.snippetTemplates.Insert(t.Name, t.Title, t.Content, t.Language)
+			}
+		case current.Title == t.Title && current.Content == t.Content && current.Language == t.Language:
+		case overwrite:
+			replaced = append(replaced, t.Name)
+			if !dryRun {
+				err = app.snippetTemplates.Update(current.ID, t.Name, t.Title, t.Content, t.Language)
+			}
+		default:
+			conflicts = append(conflicts, t.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("restoring template %q: %w", t.Name, err)
+		}
+	}
+
+	app.logger.Info("restored templates", "dry_run", dryRun, "inserted", len(inserted), "replaced", len(replaced), "conflicts", len(conflicts))
+	if len(conflicts) > 0 {
+		app.logger.Warn("templates differ from the archive and were skipped; rerun with -overwrite to replace them", "names", conflicts)
+	}
+	return nil
+}
+
+// Restore the banners that haven't ended yet and aren't already there.
+func (app *application) restoreBanners(banners []models.Banner, dryRun bool) error {
+	existing, err := app.banners.All()
+	if err != nil {
+		return err
+	}
+
+	same := func(a, b models.Banner) bool {
+		return a.Message == b.Message && a.Level == b.Level && a.Starts.Equal(b.Starts) && a.Ends.Equal(b.Ends)
+	}
+
+	inserted := 0
+	for _, b := range banners {
+		if !b.Ends.After(time.Now()) || slices.ContainsFunc(existing, func(e models.Banner) bool { return same(e, b) }) {
+			continue
+		}
+		inserted++
+		if dryRun {
+			continue
+		}
+		if _, err := app.banners.Insert(b.Message, b.Level, b.Starts, b.Ends); err != nil {
+			return fmt.Errorf("restoring banner %d: %w", b.ID, err)
+		}
+	}
+
+	app.logger.Info("restored banners", "dry_run", dryRun, "inserted", inserted)
+	return nil
+}
+
+func (app *application) seedCommand(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	n := fs.Int("n", 100, "Number of snippets to generate")
+	seedValue := fs.Uint64("seed", 0, "Random seed for reproducible data (0 picks one at random)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *n < 1 {
+		return errors.New("-n must be at least 1")
+	}
+
+	if *seedValue == 0 {
+		*seedValue = rand.Uint64()
+	}
+	r := rand.New(rand.NewPCG(*seedValue, *seedValue))
+
+	// Insert in batches so a large run doesn't hold one huge transaction.
+	for remaining := *n; remaining > 0; {
+		batch := min(remaining, 1000)
+		if err := app.snippets.BulkInsert(seed.Generate(batch, r)); err != nil {
+			return err
+		}
+		remaining -= batch
+	}
+
+	app.logger.Info("seeded snippets", "count", *n, "seed", *seedValue)
+
+	if index, ok := app.search.(search.Rebuilder); ok {
+		return index.Rebuild()
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package main
+
+type contextKey string
+
+const (
+	clientIPContextKey = contextKey("clientIP")
+	cspNonceContextKey = contextKey("cspNonce")
+)
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// How to reach MySQL, on top of what the DSN says. Apart from the
+// sockets, they apply to the primary and the replica alike.
+type dbOptions struct {
+	// "" to use the DSN's own tls parameter, "true" to require TLS and
+	// verify the server, "skip-verify" to require it without verifying,
+	// for development, or "preferred" to use it when the server offers it.
+	tls string
+	// PEM file of CA certificates to verify the server against instead of
+	// the system roots, as managed MySQL providers often require.
+	caFile string
+	// Unix sockets to connect to the primary and the replica through
+	// instead of their DSNs' addresses. A replica is usually on another
+	// host, so it doesn't share the primary's.
+	socket     string
+	readSocket string
+	// Most connections each pool opens. Requests wait for a free one
+	// rather than piling more load onto a struggling server.
+	maxOpenConns int
+}
+
+// Apply o's pool limits to db.
+func (o dbOptions) limit(db *sql.DB) {
+	db.SetMaxOpenConns(o.maxOpenConns)
+	db.SetMaxIdleConns(o.maxOpenConns)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+}
+
+// Parse the DSN given by flagName and apply o to it, connecting through
+// socket if it's set. Errors name the flag at fault.
+func (o dbOptions) config(flagName, dsn, socket string) (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %w", flagName, err)
+	}
+
+	if socket != "" {
+		cfg.Net, cfg.Addr = "unix", socket
+	}
+	if cfg.Net == "unix" {
+		fi, err := os.Stat(cfg.Addr)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("-%s: MySQL socket: %w", flagName, err)
+		case fi.Mode()&os.ModeSocket == 0:
+			return nil, fmt.Errorf("-%s: %s is not a unix socket", flagName, cfg.Addr)
+		}
+	}
+
+	if o.tls == "" {
+		if o.caFile != "" {
+			return nil, errors.New("-db-ca needs -db-tls=true")
+		}
+		return cfg, nil
+	}
+
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch o.tls {
+	case "true":
+		if cfg.Net == "unix" {
+			return nil, errors.New("-db-tls=true can't verify a server reached through a unix socket")
+		}
+		tc.ServerName, _, err = net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			tc.ServerName = cfg.Addr
+		}
+	case "skip-verify", "preferred":
+		if o.caFile != "" {
+			return nil, fmt.Errorf("-db-ca has no effect with -db-tls=%s, which doesn't verify the server", o.tls)
+		}
+		tc.InsecureSkipVerify = true
+		cfg.AllowFallbackToPlaintext = o.tls == "preferred"
+	default:
+		return nil, fmt.Errorf("-db-tls must be true, skip-verify or preferred, not %q", o.tls)
+	}
+
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("-db-ca: %w", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-db-ca: no PEM certificates found in %s", o.caFile)
+		}
+	}
+
+	cfg.TLS = tc
+	return cfg, nil
+}
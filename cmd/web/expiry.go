@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"snippety/internal/models"
+	"snippety/internal/validator"
+	"strconv"
+	"strings"
+)
+
+// How long snippets may live on this deployment, from -max-expiry and
+// -allow-never-expire, and what the create form picks unless told
+// otherwise, from -default-expiry. A public instance might allow 30 days
+// at most; a private one might keep snippets forever.
+type expiryOptions struct {
+	policy      models.ExpiryPolicy
+	defaultDays int
+}
+
+func newExpiryOptions(maxDays int, allowNever bool, defaultDays int) (expiryOptions, error) {
+	if maxDays < 1 || maxDays > models.MaxExpiryDays {
+		return expiryOptions{}, fmt.Errorf("-max-expiry must be between 1 and %d", models.MaxExpiryDays)
+	}
+
+	if defaultDays == 0 {
+		defaultDays = min(365, maxDays)
+	}
+
+	o := expiryOptions{
+		policy:      models.ExpiryPolicy{MaxDays: maxDays, AllowNever: allowNever},
+		defaultDays: defaultDays,
+	}
+	if o.policy.Check(defaultDays) != nil {
+		return expiryOptions{}, errors.New("-default-expiry must be between 1 and -max-expiry, or -1 with -allow-never-expire")
+	}
+	return o, nil
+}
+
+// Expiries offered when creating a snippet, in days, as far as the
+// maximum allows.
+var standardExpiries = []int{365, 7, 1}
+
+// The expiries a new snippet can be given, longest first: never if it's
+// allowed, then the maximum, the default and the standard ones.
+func (o expiryOptions) choices() []int {
+	var days []int
+	for _, d := range append([]int{o.policy.MaxDays, o.defaultDays}, standardExpiries...) {
+		if d >= 1 && d <= o.policy.MaxDays && !slices.Contains(days, d) {
+			days = append(days, d)
+		}
+	}
+	slices.Sort(days)
+	slices.Reverse(days)
+
+	if o.policy.AllowNever {
+		days = slices.Insert(days, 0, models.NeverExpires)
+	}
+	return days
+}
+
+// Check a new snippet's expiry is one of the choices.
+func validateExpiry(v *validator.Validator, expires int, choices []int) {
+	v.CheckField(validator.PermittedValue(expires, choices...), "expires", "must equal "+describeExpiries(choices))
+}
+
+// List expiries for an error message, such as "365, 7 or 1".
+func describeExpiries(choices []int) string {
+	s := make([]string, len(choices))
+	for i, d := range choices {
+		s[i] = strconv.Itoa(d)
+		if d == models.NeverExpires {
+			s[i] += " (never)"
+		}
+	}
+	if len(s) == 1 {
+		return s[0]
+	}
+	return strings.Join(s[:len(s)-1], ", ") + " or " + s[len(s)-1]
+}
+
+// Name an expiry choice on the create form.
+func expiryLabel(days int) string {
+	switch days {
+	case models.NeverExpires:
+		return "Never"
+	case 1:
+		return "One Day"
+	case 7:
+		return "One Week"
+	case 365:
+		return "One Year"
+	}
+	return plural(days, "day")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"snippety/internal/models"
+	"snippety/internal/pdf"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata at the top of a Markdown export.
+type markdownFrontMatter struct {
+	Title    string    `yaml:"title"`
+	ID       int       `yaml:"id"`
+	URL      string    `yaml:"url"`
+	Language string    `yaml:"language,omitempty"`
+	Created  time.Time `yaml:"created"`
+	Expires  time.Time `yaml:"expires"`
+}
+
+// Render a snippet as a Markdown document: YAML front matter, then the
+// content in a fenced code block.
+func snippetMarkdown(s models.Snippet, url string) ([]byte, error) {
+	front, err := yaml.Marshal(markdownFrontMatter{
+		Title:    s.Title,
+		ID:       s.ID,
+		URL:      url,
+		Language: s.Language,
+		Created:  s.Created,
+		Expires:  s.Expires,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The fence has to be longer than any run of backticks in the content.
+	fence := strings.Repeat("`", max(3, longestRun(s.Content, '`')+1))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "---\n%s---\n\n# %s\n\n", front, s.Title)
+	fmt.Fprintf(&buf, "%s%s\n%s\n%s\n", fence, s.Language, strings.TrimRight(s.Content, "\n"), fence)
+	return buf.Bytes(), nil
+}
+
+func longestRun(s string, c rune) int {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == c {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// Load the snippet named by the id path value for an export handler,
+// writing a 404 or error response and returning false if it can't be
+// shown.
+func (app *application) exportSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	snippet, err := app.visibleSnippet(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// Serve a snippet's content as plain text, inline or, with the download
+// query parameter, as a file. The content is copied from the store as it
+// is read, so even a very large snippet isn't held in memory.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippet, content, err := app.snippets.OpenContent(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	if !app.authorize(r, actionViewSnippet, &snippet) {
+		http.NotFound(w, r)
+		return
+	}
+
+	disposition := "inline"
+	if r.URL.Query().Has("download") {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(snippet.Bytes))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="snippet-%d.txt"`, disposition, snippet.ID))
+
+	// Once the body has started there's no way to report an error to the
+	// client but cutting the response short, which Content-Length makes
+	// detectable.
+	if _, err := io.Copy(w, content); err != nil {
+		app.logger.Error("streaming snippet failed", slog.Int("id", id), slog.String("error", err.Error()))
+	}
+}
+
+func (app *application) snippetExportMarkdown(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.exportSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := snippetMarkdown(snippet, app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID)))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippet-%d.md"`, snippet.ID))
+	w.Write(body)
+}
+
+func (app *application) snippetExportPDF(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.exportSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	expires := "expires " + humanDate(snippet.Expires)
+	if snippet.Permanent() {
+		expires = "never expires"
+	}
+	header := []string{
+		fmt.Sprintf("Snippet #%d  -  %s", snippet.ID, app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID))),
+		fmt.Sprintf("Created %s, %s", humanDate(snippet.Created), expires),
+	}
+	if snippet.Language != "" {
+		header = append(header, "Language: "+snippet.Language)
+	}
+	doc := pdf.Document{Title: snippet.Title, Header: header, Body: snippet.Content}
+
+	// The view page leaves the link out for such snippets, but it may be
+	// followed from elsewhere.
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	if errors.Is(err, pdf.ErrUnsupportedText) {
+		http.Error(w, "This snippet has characters the PDF export can't show. Use Print to save it as a PDF from your browser instead.", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippet-%d.pdf"`, snippet.ID))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"snippety/internal/models"
+	"strconv"
+	"time"
+)
+
+// Number of snippets in the feed, newest first.
+const feedItems = 20
+
+// A JSON Feed 1.1 document. See https://www.jsonfeed.org/version/1.1/.
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Title         string    `json:"title"`
+	ContentText   string    `json:"content_text"`
+	Summary       string    `json:"summary,omitempty"`
+	DatePublished time.Time `json:"date_published"`
+	// The snippet's language, so readers can filter on it.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Serve the latest published snippets as a JSON Feed.
+func (app *application) feedJSON(w http.ResponseWriter, r *http.Request) {
+	latest, err := app.snippets.List(models.SnippetListOptions{Limit: feedItems})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Listings leave Content out, and feed readers want all of it.
+	ids := make([]int, len(latest))
+	for i, s := range latest {
+		ids[i] = s.ID
+	}
+	full, err := app.snippets.GetMany(ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	content := make(map[int]string, len(full))
+	for _, s := range full {
+		content[s.ID] = s.Content
+	}
+
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       "Snippetbox",
+		HomePageURL: app.absoluteURL(r, "/"),
+		FeedURL:     app.absoluteURL(r, "/feed.json"),
+		Items:       make([]jsonFeedItem, 0, len(latest)),
+	}
+	for _, s := range latest {
+		item := jsonFeedItem{
+			ID:            strconv.Itoa(s.ID),
+			URL:           app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", s.ID)),
+			Title:         s.Title,
+			ContentText:   content[s.ID],
+			Summary:       s.Excerpt,
+			DatePublished: s.PublishAt,
+		}
+		if s.Language != "" {
+			item.Tags = []string{s.Language}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/feed+json")
+
+	err = app.writeJSON(w, http.StatusOK, feed, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
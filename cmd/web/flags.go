@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"snippety/internal/errreport"
+	"snippety/internal/models"
+	"strconv"
+	"time"
+)
+
+// Flag values that need parsing before use, as parsed by validateFlags.
+type parsedFlags struct {
+	logLevel       slog.Level
+	sameSite       http.SameSite
+	expiry         expiryOptions
+	archiveExpired bool
+	baseURL        *url.URL
+	allowedHosts   map[string]bool
+	proxies        []netip.Prefix
+	sentry         *errreport.Sentry
+}
+
+// Parse and check every flag that can be checked without touching the
+// database, the network or the disk. Both main and -check-config use it,
+// so they agree on what's valid. Each problem names the flag at fault.
+func validateFlags() (parsedFlags, []string) {
+	var (
+		p        parsedFlags
+		problems []string
+		err      error
+	)
+
+	value := func(name string) string {
+		return flag.Lookup(name).Value.String()
+	}
+	intValue := func(name string) int {
+		n, _ := strconv.Atoi(value(name))
+		return n
+	}
+	check := func(name string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("-%s: %s", name, err))
+		}
+	}
+
+	check("log-level", p.logLevel.UnmarshalText([]byte(value("log-level"))))
+	if path := value("settings"); path != "" {
+		_, err = readSettings(path)
+		check("settings", err)
+	}
+
+	p.sameSite, err = parseSameSite(value("cookie-samesite"))
+	check("cookie-samesite", err)
+	if p.sameSite == http.SameSiteNoneMode && value("cookie-secure") != "true" {
+		check("cookie-samesite", errors.New("none requires -cookie-secure"))
+	}
+	p.baseURL, err = parseBaseURL(value("base-url"))
+	check("base-url", err)
+	p.allowedHosts, err = parseAllowedHosts(value("allowed-hosts"))
+	check("allowed-hosts", err)
+	p.proxies, err = parseTrustedProxies(value("trusted-proxies"))
+	check("trusted-proxies", err)
+
+	if maxExpiry := intValue("max-expiry"); maxExpiry < 1 || maxExpiry > models.MaxExpiryDays {
+		check("max-expiry", fmt.Errorf("must be between 1 and %d", models.MaxExpiryDays))
+	} else if p.expiry, err = newExpiryOptions(maxExpiry, value("allow-never-expire") == "true", intValue("default-expiry")); err != nil {
+		check("default-expiry", errors.New("must be between 1 and -max-expiry, or -1 with -allow-never-expire"))
+	}
+	p.archiveExpired, err = parseExpiryMode(value("expiry-mode"))
+	check("expiry-mode", err)
+	if maxAge, _ := time.ParseDuration(value("form-max-age")); maxAge <= 0 {
+		check("form-max-age", errors.New("must be positive"))
+	} else if minTime, _ := time.ParseDuration(value("form-min-time")); maxAge <= minTime {
+		check("form-max-age", errors.New("must be longer than -form-min-time"))
+	}
+	if intValue("purge-after") < 0 {
+		check("purge-after", errors.New("must not be negative"))
+	}
+	if n := intValue("max-content-bytes"); n < 1 || n > models.MaxContentBytes {
+		check("max-content-bytes", fmt.Errorf("must be between 1 and %d", models.MaxContentBytes))
+	}
+	if intValue("db-max-open-conns") < 1 {
+		check("db-max-open-conns", errors.New("must be at least 1"))
+	}
+	if value("read-db-socket") != "" && value("read-dsn") == "" {
+		check("read-db-socket", errors.New("needs -read-dsn"))
+	}
+	if intValue("job-workers") < 1 {
+		check("job-workers", errors.New("must be at least 1"))
+	}
+
+	if dsn := value("sentry-dsn"); dsn != "" {
+		p.sentry, err = errreport.NewSentry(dsn)
+		check("sentry-dsn", err)
+	}
+	for _, name := range []string{"error-webhook", "alert-webhook"} {
+		if v := value(name); v != "" {
+			check(name, checkURL(v))
+		}
+	}
+
+	switch s := value("storage"); s {
+	case "mysql", "file", "memory":
+	default:
+		check("storage", fmt.Errorf("unknown storage backend %q", s))
+	}
+	switch s := value("search"); s {
+	case "sql", "embedded":
+	case "elasticsearch":
+		check("elasticsearch-url", checkURL(value("elasticsearch-url")))
+	default:
+		check("search", fmt.Errorf("unknown search backend %q", s))
+	}
+
+	return p, problems
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"snippety/internal/format"
+	"snippety/internal/hooks"
+	"snippety/internal/models"
+	"snippety/internal/validator"
+	"strings"
+)
+
+// snippetCreateForm holds the values submitted on the create page so they
+// can be shown again, with any errors, when validation fails.
+type snippetCreateForm struct {
+	Title    string
+	Content  string
+	Language string
+	Expires  int
+	validator.Validator
+}
+
+// Languages a snippet can be marked as, besides plain text ("").
+func snippetLanguages() []string {
+	return format.Languages()
+}
+
+// Check the fields shared by the create page and the API. The expiry is
+// checked separately, with validateExpiry.
+func validateSnippet(v *validator.Validator, title, content, language string, maxContentBytes int) {
+	validateTitle(v, title)
+	validateContent(v, content, maxContentBytes)
+	validateLanguage(v, language)
+}
+
+func validateTitle(v *validator.Validator, title string) {
+	v.CheckField(validator.NotBlank(title), "title", "must be provided")
+	v.CheckField(validator.MaxChars(title, models.MaxTitleChars), "title", fmt.Sprintf("must not be more than %d characters long", models.MaxTitleChars))
+}
+
+func validateContent(v *validator.Validator, content string, maxBytes int) {
+	v.CheckField(validator.ValidUTF8(content), "content", "must be valid UTF-8 text")
+	v.CheckField(validator.NotBinary(content), "content", "looks like binary data; only text can be pasted")
+	v.CheckField(validator.NotBlank(content), "content", "must be provided")
+	v.CheckField(validator.MaxBytes(content, maxBytes), "content", fmt.Sprintf("must not be more than %d bytes long", maxBytes))
+}
+
+func validateLanguage(v *validator.Validator, language string) {
+	v.CheckField(language == "" || validator.PermittedValue(language, snippetLanguages()...), "language", "must be one of "+strings.Join(snippetLanguages(), ", ")+" or empty")
+}
+
+// Check metadata sent through the API against the limits the models
+// enforce.
+func validateMetadata(v *validator.Validator, m models.Metadata) {
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		v.CheckField(models.ValidMetadataKey(k), "metadata", fmt.Sprintf("key %q must be 1 to 64 letters, digits, underscores or hyphens", k))
+	}
+	v.CheckField(len(m) <= models.MaxMetadataKeys, "metadata", fmt.Sprintf("must not have more than %d keys", models.MaxMetadataKeys))
+	b, _ := json.Marshal(m)
+	v.CheckField(len(b) <= models.MaxMetadataBytes, "metadata", fmt.Sprintf("must not be more than %d bytes as JSON", models.MaxMetadataBytes))
+}
+
+// Run the filters registered with hooks.BeforeSave on d. A rejection is
+// recorded in v against its field; other errors are returned.
+func filterDraft(v *validator.Validator, d *hooks.Draft) error {
+	err := hooks.RunFilters(d)
+	var rejection *hooks.Rejection
+	if errors.As(err, &rejection) {
+		v.AddFieldError(rejection.Field, rejection.Message)
+		return nil
+	}
+	return err
+}
+
+// How submitted content is cleaned up before it is validated and stored,
+// and how large it may be.
+type contentOptions struct {
+	normalizeNewlines  bool
+	trimTrailingSpaces bool
+	maxBytes           int
+}
+
+// Default for -max-content-bytes, the most a TEXT column holds.
+const defaultMaxContentBytes = 65535
+
+// Apply the configured clean-up to pasted content. Invalid UTF-8 is left
+// alone so validation can reject it.
+func (o contentOptions) normalize(content string) string {
+	if !o.normalizeNewlines && !o.trimTrailingSpaces {
+		return content
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	nw := o.normalizer(&b)
+	nw.WriteString(content)
+	nw.Close()
+	return b.String()
+}
+
+// Return a writer that applies the clean-up to content as it's written to
+// b, so a large body can be cleaned on its way in instead of copied again
+// once read. Close it after the last write.
+func (o contentOptions) normalizer(b *strings.Builder) *normalizeWriter {
+	return &normalizeWriter{opts: o, b: b}
+}
+
+type normalizeWriter struct {
+	opts contentOptions
+	b    *strings.Builder
+	// The last byte was a CR, already written as a newline.
+	cr bool
+	// Spaces and tabs held back until it's known whether they end a line.
+	blanks []byte
+}
+
+func (nw *normalizeWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		nw.writeByte(c)
+	}
+	return len(p), nil
+}
+
+func (nw *normalizeWriter) WriteString(s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		nw.writeByte(s[i])
+	}
+	return len(s), nil
+}
+
+func (nw *normalizeWriter) writeByte(c byte) {
+	if nw.opts.normalizeNewlines {
+		cr := nw.cr
+		nw.cr = c == '\r'
+		switch {
+		case cr && c == '\n':
+			return
+		case c == '\r':
+			c = '\n'
+		}
+	}
+
+	switch {
+	case c == '\n':
+		nw.blanks = nw.blanks[:0]
+	case nw.opts.trimTrailingSpaces && (c == ' ' || c == '\t'):
+		nw.blanks = append(nw.blanks, c)
+		return
+	default:
+		nw.b.Write(nw.blanks)
+		nw.blanks = nw.blanks[:0]
+	}
+	nw.b.WriteByte(c)
+}
+
+// Drop the blanks ending the last line.
+func (nw *normalizeWriter) Close() error {
+	nw.blanks = nil
+	return nil
+}
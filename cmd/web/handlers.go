@@ -3,20 +3,28 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"snippety/internal/format"
+	"snippety/internal/hooks"
 	"snippety/internal/models"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
-	if err != nil {
-		app.serverError(w, r, err)
+	snippets, pagination, ok := app.listPage(w, r, models.SnippetListOptions{})
+	if !ok {
 		return
 	}
 
 	data := app.newTemplateDate(r)
 	data.Snippets = snippets
+	data.Pagination = pagination
 
 	app.render(w, r, http.StatusOK, "home.tmpl.html", data)
 }
@@ -28,6 +36,86 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrExpired):
+			app.snippetExpired(w, r, http.StatusGone, snippet, nil)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	if !app.authorize(r, actionViewSnippet, &snippet) {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Snippet = snippet
+
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+// Say when a snippet expired, rather than a bare 404, and offer the admin
+// a way to bring it back. Snippets that expired before they were
+// published stay hidden like any other unpublished snippet. In archive
+// mode the admin sees the whole snippet.
+func (app *application) snippetExpired(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet, conflict *editConflict) {
+	if !app.authorize(r, actionViewSnippet, &snippet) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if app.archiveExpired && app.authorize(r, actionViewArchived, &snippet) {
+		archived, err := app.snippets.GetArchived(snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		snippet = archived
+	}
+
+	data := app.newTemplateDate(r)
+	data.Snippet = snippet
+	data.EditConflict = conflict
+
+	app.render(w, r, status, "expired.tmpl.html", data)
+}
+
+// Show a snippet on its own, without the site's navigation, styled for
+// paper.
+func (app *application) snippetPrint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippet, err := app.visibleSnippet(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Snippet = snippet
+	data.CanonicalURL = app.canonicalURL(r, fmt.Sprintf("/snippet/view/%d", id))
+
+	app.renderLayout(w, r, http.StatusOK, "print.tmpl.html", "print", data)
+}
+
+// Show a snippet's content in its language's canonical layout. Content
+// that doesn't parse is shown as-is with the parser's error.
+func (app *application) snippetFormat(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
 	snippet, err := app.snippets.Get(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
@@ -37,26 +125,455 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if !app.authorize(r, actionViewSnippet, &snippet) || !format.Supported(snippet.Language) {
+		http.NotFound(w, r)
+		return
+	}
 
 	data := app.newTemplateDate(r)
 	data.Snippet = snippet
+	data.Formatted, err = format.Format(snippet.Language, snippet.Content)
+	if err != nil {
+		data.Formatted = snippet.Content
+		data.FormatError = err.Error()
+	}
 
-	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "format.tmpl.html", data)
 }
 
-func (app *application) snippetCreateForm(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Display a form for creating a new snippet..."))
+func (app *application) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.snippetStats()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Stats = &siteStats{SnippetStats: stats}
+	for _, d := range stats.PerDay {
+		data.Stats.MaxPerDay = max(data.Stats.MaxPerDay, d.Count)
+	}
+
+	if app.analytics.Load() {
+		views, err := app.pageViewsPerDay()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Stats.ViewsPerDay = views
+		for _, d := range views {
+			data.Stats.MaxViewsPerDay = max(data.Stats.MaxViewsPerDay, d.Count)
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "stats.tmpl.html", data)
+}
+
+// Show a line diff between any two snippets, such as two versions of a
+// config pasted separately.
+func (app *application) snippetCompare(w http.ResponseWriter, r *http.Request) {
+	var snippets [2]models.Snippet
+	for i, name := range []string{"idA", "idB"} {
+		id, err := strconv.Atoi(r.PathValue(name))
+		if err != nil || id < 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		snippets[i], err = app.visibleSnippet(r, id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data := app.newTemplateDate(r)
+	data.Comparison = newComparison(snippets[0], snippets[1])
+
+	app.render(w, r, http.StatusOK, "compare.tmpl.html", data)
+}
+
+func (app *application) snippetExpiresPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	days, err := strconv.Atoi(r.PostForm.Get("days"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	version, err := strconv.Atoi(r.PostForm.Get("version"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.snippets.SetExpires(id, days, app.expiry.policy, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrInvalidExpiry):
+			app.clientError(w, http.StatusBadRequest)
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflict(w, r, id, version, days)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.snippetUpdated(id, "")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// Show the latest version of a snippet next to an expiry change that was
+// made against an older one, so the admin can decide whether to resubmit.
+func (app *application) editConflict(w http.ResponseWriter, r *http.Request, id, version, days int) {
+	conflict := &editConflict{Version: version, Days: days}
+
+	snippet, err := app.snippets.GetLatest(id)
+	if errors.Is(err, models.ErrExpired) {
+		app.snippetExpired(w, r, http.StatusConflict, snippet, conflict)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Snippet = snippet
+	data.EditConflict = conflict
+
+	app.render(w, r, http.StatusConflict, "view.tmpl.html", data)
+}
+
+func (app *application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	filter, err := models.ParseQuery(query)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Query = query
+
+	if !filter.Empty() {
+		data.Snippets, err = app.search.Search(filter)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "search.tmpl.html", data)
+}
+
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	form := snippetCreateForm{Expires: app.expiry.defaultDays}
+	templateID, err := app.startFromTemplate(r, &form)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	templates, err := app.snippetTemplates.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Form = form
+	data.Languages = snippetLanguages()
+	data.Expiries = app.expiry.choices()
+	data.FormStarted = app.formStarted()
+	data.SnippetTemplates = templates
+	data.TemplateID = templateID
+
+	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
 }
 
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	title := "O snail"
-	content := "O snail\nClimb Mount Fuji,\nBut slowly, slowly!\n\n– Kobayashi Issa"
-	expires := 7
+	r.Body = http.MaxBytesReader(w, r.Body, app.formLimit())
+	err := r.ParseForm()
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			// The rest of the body is unread, so nothing can be kept.
+			form := snippetCreateForm{Expires: app.expiry.defaultDays}
+			form.AddFieldError("content", fmt.Sprintf("must not be more than %d bytes long", app.content.maxBytes))
+			app.renderCreateForm(w, r, http.StatusRequestEntityTooLarge, form, app.formStarted())
+			return
+		}
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	id, err := app.snippets.Insert(title, content, expires)
+	reason, retry := app.botCheck(r)
+	if reason != "" && !retry {
+		app.rejectBot(w, r, reason)
+		return
+	}
+
+	expires, err := strconv.Atoi(r.PostForm.Get("expires"))
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:    r.PostForm.Get("title"),
+		Content:  app.content.normalize(r.PostForm.Get("content")),
+		Language: r.PostForm.Get("language"),
+		Expires:  expires,
+	}
+
+	if reason != "" {
+		app.logger.Info("asked for form to be submitted again",
+			slog.String("ip", clientIP(r)),
+			slog.String("reason", reason),
+		)
+		form.AddFieldError("form", "This form has expired; please check it and submit it again")
+		app.renderCreateForm(w, r, http.StatusUnprocessableEntity, form, app.formStarted())
+		return
+	}
+
+	draft := hooks.Draft{Title: form.Title, Content: form.Content, Language: form.Language}
+	if err := filterDraft(&form.Validator, &draft); err != nil {
 		app.serverError(w, r, err)
+		return
+	}
+	form.Title, form.Content, form.Language = draft.Title, draft.Content, draft.Language
+
+	validateSnippet(&form.Validator, form.Title, form.Content, form.Language, app.content.maxBytes)
+	validateExpiry(&form.Validator, form.Expires, app.expiry.choices())
+	if !form.Valid() {
+		app.renderCreateForm(w, r, http.StatusUnprocessableEntity, form, r.PostForm.Get(startedField))
+		return
 	}
 
+	id, err := app.snippets.Insert(form.Title, form.Content, form.Language, nil, form.Expires, app.expiry.policy, time.Time{})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.snippetCreated(id, form.Title, time.Time{})
+
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
+
+// Show the create form again with a submission's values and errors.
+// started is the value for its start time field: the submitted one, or a
+// fresh one when the form has to be sent again anyway.
+func (app *application) renderCreateForm(w http.ResponseWriter, r *http.Request, status int, form snippetCreateForm, started string) {
+	data := app.newTemplateDate(r)
+	data.Form = form
+	data.Languages = snippetLanguages()
+	data.Expiries = app.expiry.choices()
+	data.FormStarted = started
+	app.render(w, r, status, "create.tmpl.html", data)
+}
+
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func (app *application) adminHome(w http.ResponseWriter, r *http.Request) {
+	banners, err := app.banners.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	opts := models.SnippetListOptions{Limit: 50, IncludeExpired: true, IncludeUnpublished: true}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+	case "live":
+		opts.IncludeExpired = false
+	case "expired":
+		opts.OnlyExpired = true
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippets, pagination, ok := app.listPage(w, r, opts)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.AllBanners = banners
+	data.Snippets = snippets
+	data.Pagination = pagination
+	data.RebuildTargets = app.rebuildTargets()
+	data.ListStatus = status
+
+	app.render(w, r, http.StatusOK, "admin.tmpl.html", data)
+}
+
+// Most days the analytics endpoints will return.
+const maxAnalyticsDays = 365
+
+// Snippets created per day, as JSON for charting. The days query
+// parameter picks the range, 30 by default.
+func (app *application) adminAnalyticsCreations(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAnalyticsDays {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	perDay, err := app.snippets.CreatedPerDay(days)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	type point struct {
+		Day   string `json:"day"`
+		Count int    `json:"count"`
+	}
+	series := make([]point, len(perDay))
+	for i, d := range perDay {
+		series[i] = point{Day: d.Day.Format(time.DateOnly), Count: d.Count}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"creations": series}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) adminMaintenancePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	enabled := r.PostForm.Get("enabled") == "true"
+	app.maintenance.Store(enabled)
+	app.logger.Info("maintenance mode changed", slog.Bool("enabled", enabled))
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) adminReadOnlyPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	enabled := r.PostForm.Get("enabled") == "true"
+	app.readOnly.Store(enabled)
+	app.logger.Info("read-only mode changed", slog.Bool("enabled", enabled))
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) adminBannerCreatePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var (
+		message = strings.TrimSpace(r.PostForm.Get("message"))
+		level   = r.PostForm.Get("level")
+	)
+
+	// datetime-local inputs carry no zone; the form labels them as UTC.
+	starts, err1 := time.Parse("2006-01-02T15:04", r.PostForm.Get("starts"))
+	ends, err2 := time.Parse("2006-01-02T15:04", r.PostForm.Get("ends"))
+
+	if message == "" || utf8.RuneCountInString(message) > 500 ||
+		(level != "info" && level != "warning") ||
+		err1 != nil || err2 != nil || !ends.After(starts) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.banners.Insert(message, level, starts, ends)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.invalidateBanners()
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) adminBannerDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.banners.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	app.invalidateBanners()
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// Remember a dismissed banner in a cookie and send the visitor back to the
+// page they were on.
+func (app *application) bannerDismissPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	ids := dismissedBanners(r)
+	if !slices.Contains(ids, id) {
+		ids = append(ids, id)
+	}
+
+	// Only active banners are worth remembering, which keeps the cookie small.
+	var keep []string
+	for _, b := range app.activeBanners() {
+		if slices.Contains(ids, b.ID) {
+			keep = append(keep, strconv.Itoa(b.ID))
+		}
+	}
+
+	http.SetCookie(w, app.newCookie(dismissedBannersCookie, strings.Join(keep, "."), 30*24*60*60))
+
+	redirect := "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && strings.HasPrefix(ref.Path, "/") {
+		redirect = ref.RequestURI()
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
@@ -2,30 +2,165 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"runtime/debug"
+	"slices"
+	"snippety/internal/alert"
+	"snippety/internal/bus"
+	"snippety/internal/errreport"
+	"snippety/internal/models"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Respond to an unexpected error from a model or template. Model errors
+// that describe a problem with the request, rather than the server, get
+// the matching 4xx status instead of a 500.
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrUnavailable):
+		app.unavailable(w, r)
+		return
+	case errors.Is(err, models.ErrNoRecord):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, models.ErrDuplicate), errors.Is(err, models.ErrEditConflict):
+		app.clientError(w, http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrTooLong):
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
 	var (
 		method = r.Method
-		uri    = r.URL.RequestURI()
+		uri    = loggedURI(r)
 		trace  = string(debug.Stack())
 	)
 
 	app.logger.Error(err.Error(), slog.String("method", method), slog.String("uri", uri), slog.String("trace", trace))
+	app.reportError(r, err)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// At most this many error reports are sent at once. More are dropped, so
+// a burst of errors can't pile up goroutines.
+const maxPendingReports = 10
+
+// Send err, with the stack of serverError's caller, to the configured
+// error reporters in the background. Called only from serverError and
+// apiServerError.
+func (app *application) reportError(r *http.Request, err error) {
+	if len(app.errorReporters) == 0 {
+		return
+	}
+
+	e := errreport.NewEvent(err, 2)
+	e.Request = errreport.Request{
+		Method:   r.Method,
+		URL:      app.absoluteURL(r, loggedURI(r)),
+		ClientIP: clientIP(r),
+		Headers:  errreport.Redact(r.Header),
+	}
+
+	select {
+	case app.pendingReports <- struct{}{}:
+	default:
+		app.logger.Warn("error report dropped, too many pending")
+		app.alert("error-reports", "Error report queue is full; reports are being dropped")
+		return
+	}
+
+	go func() {
+		defer func() { <-app.pendingReports }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, reporter := range app.errorReporters {
+			if err := reporter.Report(ctx, e); err != nil {
+				app.logger.Warn("error report failed", slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+// Send an alert to the -alert-webhook, if one is set. Alerts with the same
+// key are rate limited together.
+func (app *application) alert(key, text string) {
+	if app.alerts != nil {
+		app.alerts.Alert(key, text)
+	}
+}
+
+// Check free space on each directory's filesystem every interval and
+// alert when it drops below minFree, a fraction.
+func (app *application) watchDisks(dirs []string, minFree float64, interval time.Duration) {
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+
+	for ; ; time.Sleep(interval) {
+		for _, dir := range dirs {
+			free, err := alert.DiskFree(dir)
+			if err != nil {
+				if errors.Is(err, errors.ErrUnsupported) {
+					return
+				}
+				app.logger.Warn("checking disk space failed", slog.String("dir", dir), slog.String("error", err.Error()))
+				continue
+			}
+			if free < minFree {
+				app.alert("disk:"+dir, fmt.Sprintf("Only %.1f%% disk space left for %s", free*100, dir))
+			}
+		}
+	}
+}
+
+// Render the degraded-mode page while the database circuit breaker is open.
+func (app *application) unavailable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(app.breaker.Cooldown.Seconds())))
+	app.render(w, r, http.StatusServiceUnavailable, "unavailable.tmpl.html", app.newTemplateDate(r))
+}
+
+// Report whether the request carries valid admin credentials. The admin
+// area is disabled when no password is configured.
+func (app *application) isAdmin(r *http.Request) bool {
+	if app.adminPassword == "" {
+		return false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(app.adminUser)) == 1
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(app.adminPassword)) == 1
+	return userMatch && passwordMatch
+}
+
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data templateData) {
-	ts, ok := app.templateCache[page]
+	app.renderLayout(w, r, status, page, "base", data)
+}
+
+// Render a page inside a layout other than base, such as the standalone
+// "print" layout defined by print.tmpl.html.
+func (app *application) renderLayout(w http.ResponseWriter, r *http.Request, status int, page, layout string, data templateData) {
+	ts, ok := app.template(page)
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
 		app.serverError(w, r, err)
@@ -35,7 +170,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	buf := new(bytes.Buffer)
 
 	// Write template to buffer
-	err := ts.ExecuteTemplate(buf, "base", data)
+	err := ts.ExecuteTemplate(buf, layout, data)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -49,6 +184,490 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 
 func (app *application) newTemplateDate(r *http.Request) templateData {
 	return templateData{
-		CurrentYear: time.Now().Year(),
+		CurrentYear:    time.Now().Year(),
+		Maintenance:    app.maintenance.Load(),
+		ReadOnly:       app.readOnly.Load(),
+		Banners:        app.visibleBanners(r),
+		CanonicalURL:   app.canonicalURL(r, r.URL.Path),
+		IsAdmin:        app.isAdmin(r),
+		CSPNonce:       cspNonce(r),
+		MaxExpiryDays:  app.expiry.policy.MaxDays,
+		ArchiveExpired: app.archiveExpired,
+	}
+}
+
+// Fetch a snippet the requester may see. Unpublished snippets are
+// reported as missing to everyone but the admin.
+func (app *application) visibleSnippet(r *http.Request, id int) (models.Snippet, error) {
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		return models.Snippet{}, err
+	}
+	if !app.authorize(r, actionViewSnippet, &snippet) {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+	return snippet, nil
+}
+
+// Announce a new snippet to whatever has subscribed to it; see
+// subscribe. A zero publishAt means it was published as it was created.
+func (app *application) snippetCreated(id int, title string, publishAt time.Time) {
+	app.bus.Publish(bus.Event{Topic: bus.SnippetCreated, SnippetID: id, Title: title, PublishAt: publishAt})
+}
+
+// Announce a change to a snippet. title is empty when the writer doesn't
+// have it to hand.
+func (app *application) snippetUpdated(id int, title string) {
+	app.bus.Publish(bus.Event{Topic: bus.SnippetUpdated, SnippetID: id, Title: title})
+}
+
+// Active banners are cached briefly so every page render doesn't cost a
+// query. A failed query is cached too, keeping the last known banners, so
+// a database outage costs one query per TTL rather than one per page.
+type bannerCache struct {
+	mu      sync.Mutex
+	banners []models.Banner
+	fetched time.Time
+	// Set while a query is in flight, so other renders use the cached
+	// banners rather than queue up behind it.
+	refreshing bool
+	// Bumped by invalidateBanners, so a query that started before a
+	// change doesn't refresh the cache with what it replaced.
+	generation int
+}
+
+const bannerCacheTTL = 30 * time.Second
+
+func (app *application) activeBanners() []models.Banner {
+	c := &app.bannerCache
+	c.mu.Lock()
+	if c.refreshing || time.Since(c.fetched) < bannerCacheTTL {
+		defer c.mu.Unlock()
+		return c.banners
+	}
+	c.refreshing = true
+	generation := c.generation
+	c.mu.Unlock()
+
+	banners, err := app.banners.Active()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	if generation == c.generation {
+		c.fetched = time.Now()
+	}
+
+	if err != nil {
+		// Banners are decorative; keep serving the last known set.
+		if !errors.Is(err, models.ErrUnavailable) {
+			app.logger.Error("loading banners failed", slog.String("error", err.Error()))
+		}
+		return c.banners
+	}
+
+	c.banners = banners
+	return banners
+}
+
+func (app *application) invalidateBanners() {
+	app.bannerCache.mu.Lock()
+	app.bannerCache.fetched = time.Time{}
+	app.bannerCache.generation++
+	app.bannerCache.mu.Unlock()
+}
+
+// The stats page runs several aggregate queries, so its numbers are cached
+// for a few minutes.
+type statsCache struct {
+	mu      sync.Mutex
+	stats   models.SnippetStats
+	fetched time.Time
+
+	views        []models.DayCount
+	viewsFetched time.Time
+}
+
+const (
+	statsCacheTTL = 5 * time.Minute
+	statsDays     = 30
+	statsTopN     = 10
+)
+
+func (app *application) snippetStats() (models.SnippetStats, error) {
+	c := &app.statsCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetched) < statsCacheTTL {
+		return c.stats, nil
+	}
+
+	stats, err := app.snippets.Stats(statsDays, statsTopN)
+	if err != nil {
+		if c.fetched.IsZero() {
+			return models.SnippetStats{}, err
+		}
+		// Stale numbers are better than an error page.
+		app.logger.Error("loading stats failed", slog.String("error", err.Error()))
+		return c.stats, nil
+	}
+
+	c.stats = stats
+	c.fetched = time.Now()
+	return stats, nil
+}
+
+// Return the page views on each of the last statsDays days, cached like
+// snippetStats.
+func (app *application) pageViewsPerDay() ([]models.DayCount, error) {
+	c := &app.statsCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.viewsFetched) < statsCacheTTL {
+		return c.views, nil
+	}
+
+	views, err := app.pageViews.PerDay(statsDays)
+	if err != nil {
+		if c.viewsFetched.IsZero() {
+			return nil, err
+		}
+		app.logger.Error("loading page view stats failed", slog.String("error", err.Error()))
+		return c.views, nil
+	}
+
+	c.views = views
+	c.viewsFetched = time.Now()
+	return views, nil
+}
+
+// Return the active banners the visitor hasn't dismissed.
+func (app *application) visibleBanners(r *http.Request) []models.Banner {
+	dismissed := dismissedBanners(r)
+
+	var banners []models.Banner
+	for _, b := range app.activeBanners() {
+		if !slices.Contains(dismissed, b.ID) {
+			banners = append(banners, b)
+		}
+	}
+	return banners
+}
+
+const dismissedBannersCookie = "dismissed_banners"
+
+// Read the ids of dismissed banners from their cookie.
+func dismissedBanners(r *http.Request) []int {
+	cookie, err := r.Cookie(dismissedBannersCookie)
+	if err != nil {
+		return nil
+	}
+
+	var ids []int
+	for _, field := range strings.Split(cookie.Value, ".") {
+		if id, err := strconv.Atoi(field); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Attributes applied to every cookie the app sets, so deployments behind
+// proxies or on shared parent domains can adjust them.
+type cookieOptions struct {
+	secure   bool
+	httpOnly bool
+	domain   string
+	path     string
+	sameSite http.SameSite
+}
+
+func parseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SameSite value %q", s)
+	}
+}
+
+// Build a cookie using the configured attributes.
+func (app *application) newCookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     app.cookies.path,
+		Domain:   app.cookies.domain,
+		MaxAge:   maxAge,
+		Secure:   app.cookies.secure,
+		HttpOnly: app.cookies.httpOnly,
+		SameSite: app.cookies.sameSite,
+	}
+}
+
+// Parse and validate the -base-url flag. An empty value returns nil.
+func parseBaseURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid base URL %q: want scheme://host[/path]", s)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	return u, nil
+}
+
+// Build an absolute URL for an app-relative path such as
+// "/snippet/view/1". The configured base URL is used when set; otherwise
+// it is derived from the request, whose Host the client chooses unless
+// -allowed-hosts is set; see hostTrusted.
+func (app *application) absoluteURL(r *http.Request, path string) string {
+	base := app.baseURL
+	if base == nil {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = &url.URL{Scheme: scheme, Host: r.Host}
+	}
+
+	u := *base
+	rel, err := url.Parse(path)
+	if err != nil {
+		return base.String()
+	}
+	u.Path = base.Path + rel.Path
+	u.RawQuery = rel.RawQuery
+
+	return u.String()
+}
+
+// Whether absolute URLs come from -base-url or a Host checked against
+// -allowed-hosts. Only then may they go in canonical links or responses
+// shared caches keep, where a forged Host would be served to others.
+func (app *application) hostTrusted() bool {
+	return app.baseURL != nil || len(app.allowedHosts) > 0
+}
+
+// The canonical URL for a path, or "" when the host can't be trusted.
+func (app *application) canonicalURL(r *http.Request, path string) string {
+	if !app.hostTrusted() {
+		return ""
+	}
+	return app.absoluteURL(r, path)
+}
+
+// Parse a comma-separated list of hosts, each with or without a port.
+func parseAllowedHosts(s string) (map[string]bool, error) {
+	hosts := map[string]bool{}
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+
+		u, err := url.Parse("http://" + field)
+		if err != nil || u.Host != field || u.User != nil {
+			return nil, fmt.Errorf("invalid host %q: want host or host:port", field)
+		}
+		hosts[field] = true
+	}
+
+	return hosts, nil
+}
+
+// Parse a comma-separated list of IPs and CIDRs. Bare IPs are treated as
+// single-address prefixes.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", field)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", field)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range app.proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Work out the real client address. Forwarding headers are only believed
+// when the direct peer is a trusted proxy; X-Forwarded-For is then walked
+// right to left, skipping further trusted proxies, so a client can't
+// spoof its address by sending the header itself.
+func (app *application) realClientIP(r *http.Request) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := peer.Addr().Unmap()
+
+	if !app.isTrustedProxy(ip) {
+		return ip.String()
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			ip = hop.Unmap()
+			if !app.isTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+		return ip.String()
+	}
+
+	if xri, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return xri.Unmap().String()
+	}
+
+	return ip.String()
+}
+
+// Return the Content-Security-Policy nonce set by commonHeaders.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey).(string)
+	return nonce
+}
+
+// Return the client IP stored by the realIP middleware.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// Room left in a request body for everything but content; see jsonLimit
+// and formLimit.
+const maxJSONBytes = 1 << 20
+
+// Leave room in JSON bodies for the largest content allowed, but not for
+// escaping it: decoding holds the whole body, so its size is kept close
+// to the content's. Content that escapes to more, such as markup full of
+// \u003c, should be sent as plain text to /api/v1/quick, which streams.
+func (app *application) jsonLimit() int64 {
+	return maxJSONBytes + int64(app.content.maxBytes)
+}
+
+// Leave room in the create form's body for the largest content allowed,
+// URL-encoded: each byte may take three, as < does in %3C.
+func (app *application) formLimit() int64 {
+	return maxJSONBytes + 3*int64(app.content.maxBytes)
+}
+
+// Decode a single JSON object from the request body into dst. Bodies over
+// jsonLimit, unknown fields, trailing data and wrong types are rejected with an
+// error whose message is safe to show to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := strings.Cut(ct, ";")
+		if strings.TrimSpace(mediaType) != "application/json" {
+			return errors.New("body must be sent as application/json")
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.jsonLimit())
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var (
+			syntaxError           *json.SyntaxError
+			unmarshalTypeError    *json.UnmarshalTypeError
+			invalidUnmarshalError *json.InvalidUnmarshalError
+			maxBytesError         *http.MaxBytesError
+		)
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q (expected %s)", unmarshalTypeError.Field, unmarshalTypeError.Type)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown field %s", field)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes; send large content as plain text to /api/v1/quick", maxBytesError.Limit)
+		case errors.As(err, &invalidUnmarshalError):
+			// A programming error: dst wasn't a non-nil pointer.
+			panic(err)
+		default:
+			return err
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// Write data as a JSON response with the given status.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
 	}
+	js = append(js, '\n')
+
+	// headers can override the Content-Type, as the JSON Feed does.
+	w.Header().Set("Content-Type", "application/json")
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"snippety/internal/bus"
+	"snippety/internal/hooks"
+	"snippety/internal/jobs"
+	"snippety/internal/models"
+)
+
+// Kinds of background job.
+const (
+	jobIndexSnippet   = "index_snippet"
+	jobRebuildIndex   = "rebuild_index"
+	jobPublishSnippet = "publish_snippet"
+	jobPurgeExpired   = "purge_expired"
+	jobRecordActivity = "record_activity"
+	jobAfterCreate    = "after_create"
+)
+
+// Register the handler for every kind of job.
+func (app *application) registerJobs(pool *jobs.Pool) {
+	pool.Handle(jobIndexSnippet, app.indexSnippetJob)
+	pool.Handle(jobPublishSnippet, app.publishSnippetJob)
+	pool.Handle(jobRecordActivity, app.recordActivityJob)
+	pool.Handle(jobAfterCreate, app.afterCreateJob)
+	// Rebuilding can't be stopped part way, so only check it's still
+	// wanted before starting.
+	pool.Handle(jobRebuildIndex, func(ctx context.Context, _ []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return app.rebuildSearchIndex()
+	})
+	if app.purgeAfter > 0 {
+		pool.HandleEvery(jobPurgeExpired, purgeInterval, app.purgeExpiredJob)
+	}
+}
+
+// Hook features up to the events they react to. Failures are logged
+// rather than returned so none of them ever blocks a write.
+func (app *application) subscribe(b *bus.Bus) {
+	queueIndex := func(e bus.Event) {
+		if err := app.jobs.Enqueue(jobIndexSnippet, e.SnippetID); err != nil {
+			app.logger.Error("queueing search index update failed", slog.Int("id", e.SnippetID), slog.String("error", err.Error()))
+		}
+	}
+	b.Subscribe(bus.SnippetCreated, queueIndex)
+	b.Subscribe(bus.SnippetUpdated, queueIndex)
+	b.Subscribe(bus.SnippetPublished, queueIndex)
+
+	b.Subscribe(bus.SnippetCreated, app.schedulePublish)
+
+	b.Subscribe(bus.SnippetCreated, app.recordActivity(models.EventCreated))
+	b.Subscribe(bus.SnippetUpdated, app.recordActivity(models.EventUpdated))
+	b.Subscribe(bus.SnippetPublished, app.recordActivity(models.EventPublished))
+
+	invalidateWidget := func(bus.Event) { app.invalidateWidget() }
+	b.Subscribe(bus.SnippetCreated, invalidateWidget)
+	b.Subscribe(bus.SnippetUpdated, invalidateWidget)
+	b.Subscribe(bus.SnippetPublished, invalidateWidget)
+
+	if len(hooks.AfterCreateHooks()) > 0 {
+		b.Subscribe(bus.SnippetCreated, func(e bus.Event) {
+			if err := app.jobs.Enqueue(jobAfterCreate, e.SnippetID); err != nil {
+				app.logger.Error("queueing after create hooks failed", slog.Int("id", e.SnippetID), slog.String("error", err.Error()))
+			}
+		})
+	}
+}
+
+type activityPayload struct {
+	Kind      models.EventKind `json:"kind"`
+	SnippetID int              `json:"snippet_id"`
+	// Empty when the event didn't carry it, and the job looks it up.
+	Title string `json:"title,omitempty"`
+}
+
+// Queue an entry of the given kind in the activity log for each event.
+func (app *application) recordActivity(kind models.EventKind) bus.Subscriber {
+	return func(e bus.Event) {
+		err := app.jobs.Enqueue(jobRecordActivity, activityPayload{Kind: kind, SnippetID: e.SnippetID, Title: e.Title})
+		if err != nil {
+			app.logger.Error("queueing activity failed", slog.Int("id", e.SnippetID), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (app *application) recordActivityJob(ctx context.Context, payload []byte) error {
+	var p activityPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	if p.Title == "" {
+		snippet, err := app.snippets.GetLatest(p.SnippetID)
+		if errors.Is(err, models.ErrNoRecord) || errors.Is(err, models.ErrExpired) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p.Title = snippet.Title
+	}
+	return app.events.Record(p.Kind, p.SnippetID, p.Title)
+}
+
+// Run the AfterCreate hooks on a new snippet.
+func (app *application) afterCreateJob(ctx context.Context, payload []byte) error {
+	var id int
+	if err := json.Unmarshal(payload, &id); err != nil {
+		return err
+	}
+
+	snippet, err := app.snippets.GetLatest(id)
+	if errors.Is(err, models.ErrNoRecord) || errors.Is(err, models.ErrExpired) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fn := range hooks.AfterCreateHooks() {
+		app.runHook(fn, snippet)
+	}
+	return nil
+}
+
+func (app *application) runHook(fn func(models.Snippet), snippet models.Snippet) {
+	defer func() {
+		if v := recover(); v != nil {
+			app.logger.Error("after create hook panicked", slog.Int("id", snippet.ID), slog.String("panic", fmt.Sprint(v)))
+		}
+	}()
+	fn(snippet)
+}
+
+// Bring the search index up to date with a snippet, removing it if it has
+// expired since the job was queued.
+func (app *application) indexSnippetJob(ctx context.Context, payload []byte) error {
+	var id int
+	if err := json.Unmarshal(payload, &id); err != nil {
+		return err
+	}
+
+	snippet, err := app.snippets.GetLatest(id)
+	if errors.Is(err, models.ErrNoRecord) {
+		return app.search.Delete(id)
+	}
+	if err != nil {
+		return err
+	}
+	return app.search.Index(snippet)
+}
+
+// Failed jobs shown on the activity page.
+const deadJobsShown = 20
+
+// Write the job queue's metrics for /metrics.
+func (app *application) jobMetrics(w io.Writer) {
+	stats := app.jobs.Stats()
+	counter := func(name, help string, v int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	counter("snippety_jobs_succeeded_total", "Background jobs run successfully by this process.", stats.Succeeded)
+	counter("snippety_jobs_failed_total", "Failed background job attempts in this process.", stats.Failed)
+	counter("snippety_jobs_dead_total", "Background jobs this process gave up on.", stats.Died)
+
+	counts, err := app.jobs.Store.Counts()
+	if err != nil {
+		return
+	}
+	gauge := func(name, help string, v int) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+	}
+	gauge("snippety_jobs_pending", "Background jobs waiting to run or running.", counts.Pending)
+	gauge("snippety_jobs_dead", "Background jobs given up on and kept for inspection.", counts.Dead)
+}
+
+// Queue a job to announce a scheduled snippet when its publish time comes.
+func (app *application) schedulePublish(e bus.Event) {
+	if e.PublishAt.IsZero() || !e.PublishAt.After(e.Time) {
+		return
+	}
+	if err := app.jobs.EnqueueAt(jobPublishSnippet, e.SnippetID, e.PublishAt); err != nil {
+		app.logger.Error("queueing publish failed", slog.Int("id", e.SnippetID), slog.String("error", err.Error()))
+	}
+}
+
+// Publish SnippetPublished for a scheduled snippet whose time has come. A
+// job that runs early, by the clocks disagreeing, is queued again for the
+// publish time; one for a snippet that has gone does nothing.
+func (app *application) publishSnippetJob(ctx context.Context, payload []byte) error {
+	var id int
+	if err := json.Unmarshal(payload, &id); err != nil {
+		return err
+	}
+
+	snippet, err := app.snippets.GetLatest(id)
+	if errors.Is(err, models.ErrNoRecord) || errors.Is(err, models.ErrExpired) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !snippet.Published() {
+		return app.jobs.EnqueueAt(jobPublishSnippet, id, snippet.PublishAt)
+	}
+
+	app.bus.Publish(bus.Event{Topic: bus.SnippetPublished, SnippetID: id, Title: snippet.Title})
+	return nil
+}
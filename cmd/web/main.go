@@ -1,48 +1,385 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"snippety/internal/alert"
+	"snippety/internal/breaker"
+	"snippety/internal/bus"
+	"snippety/internal/errreport"
+	"snippety/internal/jobs"
+	"snippety/internal/logfile"
 	"snippety/internal/models"
-	"text/template"
+	"snippety/internal/search"
+	"snippety/internal/secrets"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 type application struct {
-	logger        *slog.Logger
-	snippets      *models.SnippetModel
-	templateCache map[string]*template.Template
+	logger           *slog.Logger
+	snippets         models.SnippetModelInterface
+	banners          models.BannerModelInterface
+	snippetTemplates models.TemplateModelInterface
+	pageViews        models.PageViewModelInterface
+	events           models.EventModelInterface
+	shares           models.ShareModelInterface
+	visitors         visitorHasher
+	pageViewBuffer   pageViewBuffer
+	analytics        atomic.Bool
+	accessLogger     *log.Logger
+	bannerCache      bannerCache
+	statsCache       statsCache
+	suggestCache     suggestCache
+	widgetCache      widgetCache
+	search           search.Backend
+	dbPools          map[string]*sql.DB
+	breaker          *breaker.Breaker
+	templateCache    map[string]*template.Template
+	assets           *assets
+	adminUser        string
+	adminPassword    string
+	expiry           expiryOptions
+	minify           bool
+	maintenance      atomic.Bool
+	readOnly         atomic.Bool
+	cookies          cookieOptions
+	content          contentOptions
+	baseURL          *url.URL
+	proxies          []netip.Prefix
+	// Host headers answered; empty answers any. See hostTrusted.
+	allowedHosts map[string]bool
+
+	// Where unexpected errors are sent, and a semaphore limiting how many
+	// reports are in flight.
+	errorReporters []errreport.Reporter
+	pendingReports chan struct{}
+
+	// Optional webhook for critical events, and the panic rate that
+	// triggers one.
+	alerts *alert.Webhook
+	panics alert.Burst
+
+	// Key for signing share links.
+	shareSecret []byte
+	// Bearer tokens accepted by the quick save endpoint.
+	quickSaveTokens [][]byte
+
+	// Settings changed by reloadSettings.
+	settingsPath   string
+	logLevel       *slog.LevelVar
+	suggestLimiter *rateLimiter
+
+	// Background job queue, run while serving.
+	jobs *jobs.Pool
+	// Where writes are announced to the features that react to them.
+	bus *bus.Bus
+
+	// Guards templateCache, which can be rebuilt while serving.
+	templateMu sync.RWMutex
+	themeDir   string
+
+	// Quickest a person can fill in the create form, and longest it stays
+	// open before it must be reloaded; see botCheck.
+	formMinTime time.Duration
+	formMaxAge  time.Duration
+	formSecret  []byte
+
+	// Expired snippets stay readable by their owner; see -expiry-mode.
+	archiveExpired bool
+	// How long after expiring snippets are deleted; zero keeps them.
+	purgeAfter time.Duration
 }
 
 func main() {
 
 	// Flags
 
+	adminUser := flag.String("admin-user", "admin", "Username for the admin area")
+	adminPassword := flag.String("admin-password", "", "Password for the admin area (empty disables it)")
+	maintenance := flag.Bool("maintenance", false, "Start in maintenance mode")
+	readOnly := flag.Bool("read-only", false, "Start in read-only mode (writes are refused)")
+	minifyHTML := flag.Bool("minify-html", false, "Minify HTML responses before sending them")
+	logFile := flag.String("log-file", "", "Write the application log to this file instead of stdout")
+	flag.String("log-level", "debug", "Minimum level logged (debug, info, warn or error)")
+	settingsPath := flag.String("settings", "", "YAML file of settings reloaded on SIGHUP: log_level, maintenance, read_only, analytics, suggest_rate and suggest_burst")
+	var logRotation logfile.Options
+	logMaxSize := flag.Int("log-max-size", 100, "Rotate log files before they grow past this many megabytes (0 disables)")
+	flag.DurationVar(&logRotation.MaxAge, "log-max-age", 24*time.Hour, "Rotate log files once they have been open this long (0 disables)")
+	flag.BoolVar(&logRotation.Compress, "log-compress", true, "Gzip rotated log files")
+	flag.IntVar(&logRotation.Keep, "log-keep", 7, "Number of rotated log files to keep (0 keeps all)")
+	flag.String("sentry-dsn", "", "Report panics and server errors to this Sentry project DSN")
+	errorWebhook := flag.String("error-webhook", "", "Report panics and server errors as JSON POSTs to this URL")
+	alertWebhook := flag.String("alert-webhook", "", "Slack-compatible webhook URL for alerts about repeated panics, the database circuit breaker and low disk space")
+	alertInterval := flag.Duration("alert-interval", 15*time.Minute, "Minimum time between two alerts about the same problem")
+	alertDiskFree := flag.Float64("alert-disk-free", 10, "Alert when free space on a disk the app writes to drops below this percentage")
+	shareSecret := flag.String("share-secret", "", "Secret for signing share links; changing it revokes all links (empty picks a random one, so links stop working on restart)")
+	quickSaveTokens := flag.String("quick-save-tokens", "", "Comma-separated bearer tokens for POST /api/v1/quick, which can only create snippets (empty disables it)")
+	accessLogPath := flag.String("access-log", "", "Write an Apache combined format access log to this file, or - for stdout (empty disables it)")
+	analytics := flag.Bool("analytics", false, "Count page views per path and day, without cookies, for the admin analytics page")
+	flag.Int("max-expiry", 365, "Maximum number of days a snippet's expiry can be set to")
+	flag.Bool("allow-never-expire", false, "Let snippets be kept forever, as well as for up to -max-expiry days")
+	flag.Int("default-expiry", 0, "Days a new snippet expires in unless another choice is made (0 for a year, or -max-expiry if shorter; -1 for never, with -allow-never-expire)")
+	flag.String("expiry-mode", expiryHide, "What happens to expired snippets: hide (only the expiry date is shown) or archive (the admin can still read them)")
+	purgeAfter := flag.Int("purge-after", 0, "Delete snippets this many days after they expire (0 keeps them)")
+	formMinTime := flag.Duration("form-min-time", 2*time.Second, "Reject create form submissions sent sooner than this after the form was shown, as bots (0 disables)")
+	formMaxAge := flag.Duration("form-max-age", 24*time.Hour, "Reject create form submissions sent longer than this after the form was shown, so a captured form can't be replayed for ever")
+	formSecret := flag.String("form-secret", "", "Secret for signing when the create form was shown; set it to the same value on every instance (empty picks a random one, so forms open across a restart must be reloaded)")
+	var content contentOptions
+	flag.BoolVar(&content.normalizeNewlines, "normalize-newlines", true, "Convert CRLF and CR line endings in pasted content to LF")
+	flag.BoolVar(&content.trimTrailingSpaces, "trim-trailing-whitespace", false, "Strip trailing spaces and tabs from each line of pasted content")
+	flag.IntVar(&content.maxBytes, "max-content-bytes", defaultMaxContentBytes, fmt.Sprintf("Largest snippet content accepted, in bytes, up to %d (above 65535 needs a MEDIUMTEXT content column; see -migrate-db). Each create request may hold a few times this in memory", models.MaxContentBytes))
+
+	var cookies cookieOptions
+	flag.BoolVar(&cookies.secure, "cookie-secure", false, "Set the Secure attribute on cookies (enable when served over HTTPS)")
+	flag.BoolVar(&cookies.httpOnly, "cookie-httponly", true, "Set the HttpOnly attribute on cookies")
+	flag.StringVar(&cookies.domain, "cookie-domain", "", "Domain attribute for cookies (empty means host-only)")
+	flag.StringVar(&cookies.path, "cookie-path", "/", "Path attribute for cookies")
+	flag.String("cookie-samesite", "lax", "SameSite attribute for cookies (lax, strict or none)")
+	storage := flag.String("storage", "mysql", "Storage backend (mysql, file or memory)")
+	dataDir := flag.String("data-dir", "./data", "Directory for the file storage backend")
 	dsn := flag.String("dsn", "web:math@/snippety?parseTime=true", "MySQL data source name")
 	addr := flag.String("addr", ":4000", "HTTP network address")
+	themeDir := flag.String("theme-dir", "", "Directory of templates laid out like ui/html that replace the defaults file by file")
+	flag.String("trusted-proxies", "", "Comma-separated proxy IPs/CIDRs whose X-Forwarded-For and X-Real-IP headers are trusted")
+	flag.String("base-url", "", "External base URL used for absolute links, e.g. https://snippety.example.com (empty derives it from each request)")
+	flag.String("allowed-hosts", "", "Comma-separated Host headers to answer, e.g. snippety.example.com,localhost:4000 (empty answers any; the -base-url host is always allowed)")
+	readDSN := flag.String("read-dsn", "", "Optional MySQL data source name for a read-only replica")
+	var dbOpts dbOptions
+	flag.StringVar(&dbOpts.tls, "db-tls", "", "Connect to MySQL over TLS: true (verify the server), skip-verify (development only) or preferred (empty uses the DSN's tls parameter)")
+	flag.StringVar(&dbOpts.caFile, "db-ca", "", "PEM file of CA certificates to verify MySQL's certificate against, with -db-tls=true")
+	flag.StringVar(&dbOpts.socket, "db-socket", "", "Connect to the MySQL primary through this unix socket instead of the -dsn address")
+	flag.StringVar(&dbOpts.readSocket, "read-db-socket", "", "Connect to the read replica through this unix socket instead of the -read-dsn address")
+	flag.IntVar(&dbOpts.maxOpenConns, "db-max-open-conns", 25, "Most connections to open to each MySQL server")
+	slowQuery := flag.Duration("slow-query", 200*time.Millisecond, "Log database queries slower than this (0 disables)")
+	dbStatsInterval := flag.Duration("db-stats-interval", time.Minute, "How often to log database pool statistics (0 disables)")
+	breakerThreshold := flag.Int("breaker-threshold", 5, "Consecutive database failures before serving the unavailable page")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "How long to wait before retrying the database after the breaker opens")
+	dbWait := flag.Duration("db-wait", 30*time.Second, "How long to keep retrying the initial database connection")
+	initDB := flag.Bool("init-db", false, "Create the tables and indexes if the MySQL database is empty")
+	migrateDB := flag.Bool("migrate-db", false, "Bring a MySQL database made by an older version up to date, adding missing tables and columns")
+	jobWorkers := flag.Int("job-workers", jobs.DefaultWorkers, "Number of background job workers")
+	searchBackendName := flag.String("search", "sql", "Search backend (sql, embedded or elasticsearch)")
+	searchIndex := flag.String("search-index", "./search.idx", "Path to the embedded search index file")
+	elasticURL := flag.String("elasticsearch-url", "http://localhost:9200", "Elasticsearch/OpenSearch base URL")
+	elasticIndex := flag.String("elasticsearch-index", "snippets", "Elasticsearch/OpenSearch index name")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	checkOnly := flag.Bool("check-config", false, "Print the effective configuration with secrets redacted, check the database, directories and address, and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(readBuildInfo())
+		return
+	}
+	if err := resolveSecretFlags(secrets.FromEnv()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *checkOnly {
+		os.Exit(checkConfig(os.Stdout))
+	}
+	parsed, problems := validateFlags()
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		os.Exit(1)
+	}
+
 	// Logger
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	logRotation.MaxBytes = int64(*logMaxSize) << 20
+
+	var logOutput io.Writer = os.Stdout
+	if *logFile != "" {
+		f, err := logfile.Open(*logFile, logRotation)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logOutput = f
+	}
+
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(parsed.logLevel)
+
+	logger := slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{
 		AddSource: true,
-		Level:     slog.LevelDebug,
+		Level:     logLevel,
 	}))
 
-	// Database
+	cookies.sameSite = parsed.sameSite
+
+	accessLogger, err := openAccessLog(*accessLogPath, logRotation)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	var errorReporters []errreport.Reporter
+	reportClient := &http.Client{Timeout: 10 * time.Second}
+	if sentry := parsed.sentry; sentry != nil {
+		sentry.Client = reportClient
+		sentry.Release = readBuildInfo().Version
+		sentry.ServerName, _ = os.Hostname()
+		errorReporters = append(errorReporters, sentry)
+	}
+	if *errorWebhook != "" {
+		errorReporters = append(errorReporters, &errreport.Webhook{URL: *errorWebhook, Client: reportClient})
+	}
+
+	// Storage
+
+	var (
+		store     models.Storage
+		dbPools   map[string]*sql.DB
+		dbBreaker *breaker.Breaker
+	)
+
+	switch *storage {
+	case "mysql":
+		cfg, err := dbOpts.config("dsn", *dsn, dbOpts.socket)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		db, err := openDB(cfg, *dbWait, logger)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		dbOpts.limit(db)
+
+		dbBreaker = &breaker.Breaker{Threshold: *breakerThreshold, Cooldown: *breakerCooldown}
+		snippets := &models.SnippetModel{
+			DB:        db,
+			Logger:    logger,
+			SlowQuery: *slowQuery,
+			Breaker:   dbBreaker,
+		}
+
+		if *readDSN != "" {
+			readCfg, err := dbOpts.config("read-dsn", *readDSN, dbOpts.readSocket)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			readConnector, err := mysql.NewConnector(readCfg)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			readDB := sql.OpenDB(readConnector)
+			dbOpts.limit(readDB)
 
-	db, err := openDB(*dsn)
+			// A replica that is down only costs a fallback to the primary, so
+			// don't refuse to start over it.
+			if err := readDB.Ping(); err != nil {
+				logger.Warn("read replica unavailable, reads will use the primary until it recovers", slog.String("error", err.Error()))
+			}
+			snippets.ReadDB = readDB
+		}
+
+		mysqlStore := models.NewMySQLStorage(snippets)
+		switch {
+		case *initDB:
+			created, err := mysqlStore.InitSchema()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if created {
+				logger.Info("created database schema")
+			}
+		case *migrateDB:
+			done, err := mysqlStore.Migrate()
+			for _, step := range done {
+				logger.Info("migrated database", slog.String("step", step))
+			}
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+		default:
+			if pending, err := mysqlStore.PendingMigrations(); err == nil && len(pending) > 0 {
+				logger.Warn("database schema is out of date; restart with -init-db if it is a new, empty database, or -migrate-db otherwise", slog.Any("pending", pending))
+			}
+		}
+
+		// Refuse to start rather than let MySQL cut off content that passed
+		// validation.
+		if n, err := mysqlStore.ContentColumnBytes(); err == nil && int64(content.maxBytes) > n {
+			logger.Error("-max-content-bytes is larger than the database's content column holds; run with -migrate-db or lower it", slog.Int("max_content_bytes", content.maxBytes), slog.Int64("column_bytes", n))
+			os.Exit(1)
+		}
+		dbPools = mysqlStore.Pools()
+		store = mysqlStore
+	case "file":
+		fileStore, err := models.OpenFileStorage(*dataDir)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		store = fileStore
+	case "memory":
+		logger.Warn("using in-memory storage, snippets will be lost on restart")
+		store = models.NewMemoryStorage()
+	}
+	defer store.Close()
+
+	snippets := store.Snippets()
+
+	// Search
+
+	sqlSearch := &search.SQL{Snippets: snippets}
+
+	var searchBackend search.Backend
+	switch *searchBackendName {
+	case "sql":
+		searchBackend = sqlSearch
+	case "embedded":
+		searchBackend, err = search.OpenEmbedded(*searchIndex, snippets)
+	case "elasticsearch":
+		// A cluster that's down is no reason to refuse to start: searches
+		// fall back to SQL and index jobs retry until it's back.
+		es := search.NewElasticsearch(*elasticURL, *elasticIndex, snippets)
+		if err := es.Prepare(); err != nil {
+			logger.Warn("elasticsearch unavailable, searching with SQL until it recovers", slog.String("error", err.Error()))
+		}
+		searchBackend = &search.Fallback{Primary: es, Secondary: sqlSearch, Logger: logger}
+	}
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	defer db.Close()
 
-	templateCache, err := newTemplateCache()
+	staticAssets, err := newAssets("./ui/static")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	templateCache, err := newTemplateCache(staticAssets, *themeDir)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -51,31 +388,223 @@ func main() {
 	// Application
 
 	app := &application{
-		logger:        logger,
-		snippets:      &models.SnippetModel{DB: db},
-		templateCache: templateCache,
+		logger:           logger,
+		snippets:         snippets,
+		banners:          store.Banners(),
+		snippetTemplates: store.Templates(),
+		pageViews:        store.PageViews(),
+		events:           store.Events(),
+		shares:           store.Shares(),
+		accessLogger:     accessLogger,
+		search:           searchBackend,
+		dbPools:          dbPools,
+		breaker:          dbBreaker,
+		templateCache:    templateCache,
+		themeDir:         *themeDir,
+		formMinTime:      *formMinTime,
+		formMaxAge:       *formMaxAge,
+		formSecret:       []byte(*formSecret),
+		archiveExpired:   parsed.archiveExpired,
+		purgeAfter:       time.Duration(*purgeAfter) * 24 * time.Hour,
+		assets:           staticAssets,
+		adminUser:        *adminUser,
+		adminPassword:    *adminPassword,
+		expiry:           parsed.expiry,
+		minify:           *minifyHTML,
+		cookies:          cookies,
+		content:          content,
+		baseURL:          parsed.baseURL,
+		proxies:          parsed.proxies,
+		allowedHosts:     parsed.allowedHosts,
+
+		errorReporters: errorReporters,
+		pendingReports: make(chan struct{}, maxPendingReports),
+
+		panics: alert.Burst{N: 3, Window: 10 * time.Minute},
+
+		shareSecret:     []byte(*shareSecret),
+		quickSaveTokens: parseQuickSaveTokens(*quickSaveTokens),
+
+		settingsPath:   *settingsPath,
+		logLevel:       logLevel,
+		suggestLimiter: newRateLimiter(suggestRate, suggestBurst),
+
+		jobs: &jobs.Pool{Store: store.Jobs(), Logger: logger, Workers: *jobWorkers},
+		bus:  &bus.Bus{Logger: logger},
+	}
+	app.registerJobs(app.jobs)
+	app.subscribe(app.bus)
+	if *shareSecret == "" {
+		logger.Warn("no -share-secret set, share links will stop working on restart")
+		app.shareSecret = make([]byte, 32)
+		rand.Read(app.shareSecret)
+	}
+	if len(app.allowedHosts) > 0 && app.baseURL != nil {
+		app.allowedHosts[strings.ToLower(app.baseURL.Host)] = true
+	}
+	if !app.hostTrusted() {
+		logger.Warn("no -base-url or -allowed-hosts set, canonical links are left out and the widget isn't cached by shared caches")
+	}
+	if *formSecret == "" {
+		app.formSecret = make([]byte, 32)
+		rand.Read(app.formSecret)
+	}
+	if *alertWebhook != "" {
+		app.alerts = &alert.Webhook{
+			URL:      *alertWebhook,
+			Client:   &http.Client{Timeout: 10 * time.Second},
+			Interval: *alertInterval,
+			OnError: func(err error) {
+				logger.Warn("sending alert failed", slog.String("error", err.Error()))
+			},
+		}
+	}
+	if dbBreaker != nil {
+		dbBreaker.OnOpen = func() {
+			app.alert("breaker", fmt.Sprintf("Database circuit breaker opened; serving degraded pages, retrying in %s", dbBreaker.Cooldown))
+		}
+	}
+	app.maintenance.Store(*maintenance)
+	app.readOnly.Store(*readOnly)
+	app.analytics.Store(*analytics)
+	if err := app.reloadSettings(); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Commands
+
+	if flag.NArg() > 0 {
+		err := app.runCommand(flag.Arg(0), flag.Args()[1:])
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Cancelled on SIGINT or SIGTERM, to stop the server and the job pool.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go app.reloadOnSIGHUP()
+	jobsDone := make(chan struct{})
+	go func() {
+		app.jobs.Run(ctx)
+		close(jobsDone)
+	}()
+	go app.flushPageViews(pageViewFlushInterval)
+
+	if *dbStatsInterval > 0 && len(dbPools) > 0 {
+		go app.logDBStats(*dbStatsInterval)
+	}
+
+	if app.alerts != nil {
+		var dirs []string
+		if *storage == "file" {
+			dirs = append(dirs, *dataDir)
+		}
+		if *searchBackendName == "embedded" {
+			dirs = append(dirs, filepath.Dir(*searchIndex))
+		}
+		if *logFile != "" {
+			dirs = append(dirs, filepath.Dir(*logFile))
+		}
+		if *accessLogPath != "" && *accessLogPath != "-" {
+			dirs = append(dirs, filepath.Dir(*accessLogPath))
+		}
+		go app.watchDisks(dirs, *alertDiskFree/100, time.Minute)
 	}
 
 	// Start server
 
 	logger.Info("starting server", "addr", *addr)
 
-	err = http.ListenAndServe(*addr, app.routes())
-	logger.Error(err.Error())
-	os.Exit(1)
+	// Timeouts keep slow or stalled clients from holding connections, and
+	// whatever the handlers hold with them, indefinitely. They leave room
+	// to upload or download the largest snippet on a slow link.
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           app.routes(),
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       time.Minute,
+	}
+
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down server")
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			logger.Warn("shutting down server failed", slog.String("error", err.Error()))
+		}
+	}()
+
+	err = srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Let jobs in progress stop, then write out page views still buffered.
+	<-jobsDone
+	if !app.readOnly.Load() {
+		if err := app.flushPageViewsOnce(); err != nil {
+			logger.Error("recording page views failed", slog.String("error", err.Error()))
+		}
+	}
+	logger.Info("stopped server")
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+// How long requests in progress get to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// Open a connection pool and ping it, retrying with exponential backoff
+// until wait has elapsed. Databases started alongside the app in
+// containers are often not accepting connections yet.
+func openDB(cfg *mysql.Config, wait time.Duration, logger *slog.Logger) (*sql.DB, error) {
+	connector, err := mysql.NewConnector(cfg)
 	if err != nil {
 		return nil, err
 	}
+	db := sql.OpenDB(connector)
+
+	deadline := time.Now().Add(wait)
+	delay := 500 * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			return db, nil
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			db.Close()
+			return nil, err
+		}
+
+		logger.Warn("database not ready, retrying", slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.String("error", err.Error()))
+		time.Sleep(delay)
+		delay = min(delay*2, 10*time.Second)
+	}
+}
 
-	err = db.Ping()
+// Open the access log named by -access-log: nil if empty, stdout for "-",
+// otherwise a file rotated like the application log.
+func openAccessLog(path string, rotation logfile.Options) (*log.Logger, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		return log.New(os.Stdout, "", 0), nil
+	}
+
+	f, err := logfile.Open(path, rotation)
 	if err != nil {
-		db.Close()
 		return nil, err
 	}
-
-	return db, nil
+	return log.New(f, "", 0), nil
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Log connection pool statistics every interval until the process exits.
+func (app *application) logDBStats(interval time.Duration) {
+	for range time.Tick(interval) {
+		for name, db := range app.dbPools {
+			s := db.Stats()
+			app.logger.Info("db pool stats",
+				slog.String("pool", name),
+				slog.Int("open", s.OpenConnections),
+				slog.Int("in_use", s.InUse),
+				slog.Int("idle", s.Idle),
+				slog.Int64("wait_count", s.WaitCount),
+				slog.Duration("wait_duration", s.WaitDuration),
+			)
+		}
+	}
+}
+
+// Serve metrics in the Prometheus text exposition format. Only the admin
+// may read them; point the scraper's basic_auth at the admin credentials.
+func (app *application) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	stats := make(map[string]sql.DBStats, len(app.dbPools))
+	for name, db := range app.dbPools {
+		stats[name] = db.Stats()
+	}
+
+	dbMetric(w, stats, "snippety_db_open_connections", "gauge", "Established connections, in use and idle.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	dbMetric(w, stats, "snippety_db_in_use_connections", "gauge", "Connections currently in use.", func(s sql.DBStats) float64 { return float64(s.InUse) })
+	dbMetric(w, stats, "snippety_db_idle_connections", "gauge", "Idle connections.", func(s sql.DBStats) float64 { return float64(s.Idle) })
+	dbMetric(w, stats, "snippety_db_max_open_connections", "gauge", "Maximum open connections (0 is unlimited).", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	dbMetric(w, stats, "snippety_db_wait_count_total", "counter", "Connections waited for.", func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	dbMetric(w, stats, "snippety_db_wait_duration_seconds_total", "counter", "Time spent waiting for a connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+
+	app.jobMetrics(w)
+}
+
+func dbMetric(w io.Writer, stats map[string]sql.DBStats, name, kind, help string, value func(sql.DBStats) float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for pool, s := range stats {
+		fmt.Fprintf(w, "%s{pool=%q} %g\n", name, pool, value(s))
+	}
+}
@@ -1,14 +1,33 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"snippety/internal/minify"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Set security headers on every response. The Content-Security-Policy
+// carries a fresh nonce per request, stored in the request context, so
+// templates can allow an inline <script> or <style> with nonce="{{.CSPNonce}}"
+// without resorting to 'unsafe-inline'.
 func commonHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+		b := make([]byte, 16)
+		rand.Read(b)
+		nonce := base64.StdEncoding.EncodeToString(b)
+		r = r.WithContext(context.WithValue(r.Context(), cspNonceContextKey, nonce))
+
+		w.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'self'; script-src 'self' 'nonce-%[1]s'; style-src 'self' 'nonce-%[1]s' fonts.googleapis.com; font-src fonts.gstatic.com", nonce))
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "deny")
@@ -20,13 +39,39 @@ func commonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// checkHost turns away requests for a Host not in -allowed-hosts, when it
+// is set, so links built from the Host can be trusted. A listed host
+// without a port allows it with any.
+func (app *application) checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(app.allowedHosts) > 0 {
+			host := strings.ToLower(r.Host)
+			name, _, err := net.SplitHostPort(host)
+			if !app.allowedHosts[host] && (err != nil || !app.allowedHosts[name]) {
+				app.clientError(w, http.StatusMisdirectedRequest)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Resolve the real client IP once per request and store it in the
+// request context for logging and anything else that keys on the client.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPContextKey, app.realClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
-			ip     = r.RemoteAddr
+			ip     = clientIP(r)
 			proto  = r.Proto
 			method = r.Method
-			uri    = r.URL.RequestURI()
+			uri    = loggedURI(r)
 		)
 
 		app.logger.Info("received request", slog.Any("ip", ip), slog.Any("proto", proto), slog.Any("method", method), slog.Any("uri", uri))
@@ -35,7 +80,6 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 	})
 }
 
-
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event of a panic as Go unwinds the stack).
@@ -43,10 +87,279 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 			// Built-in recover function checks if there has been a panic or not
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w,r,fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
+
+				if app.panics.Hit() {
+					app.alert("panic", fmt.Sprintf("%d or more panics in the last %s; latest: %v (%s %s)", app.panics.N, app.panics.Window, err, r.Method, r.URL.Path))
+				}
 			}
 		}()
 
-		next.ServeHTTP(w,r)
+		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// While maintenance mode is on, answer everything except static files,
+// health checks and admin requests with a 503 maintenance page.
+func (app *application) maintenanceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.maintenance.Load() || app.authorize(r, actionBypassMaintenance, nil) ||
+			r.URL.Path == "/healthz" ||
+			strings.HasPrefix(r.URL.Path, "/static/") ||
+			strings.HasPrefix(r.URL.Path, "/admin") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiUnavailable(w, r, 300)
+			return
+		}
+
+		w.Header().Set("Retry-After", "300")
+		app.render(w, r, http.StatusServiceUnavailable, "maintenance.tmpl.html", app.newTemplateDate(r))
+	})
+}
+
+// Requests read-only mode lets through although they aren't reads: the
+// admin switches, which write nothing to the database and include the one
+// that turns the mode off again.
+var readOnlyExempt = map[string]bool{
+	"POST /admin/read-only":   true,
+	"POST /admin/maintenance": true,
+	"POST /admin/reload":      true,
+}
+
+// While read-only mode is on, refuse anything that could write, keeping
+// reads available. Dismissing a banner only sets a cookie, so it's allowed
+// too.
+func (app *application) readOnlyMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if !app.readOnly.Load() || safe ||
+			readOnlyExempt[r.Method+" "+r.URL.Path] ||
+			strings.HasPrefix(r.URL.Path, "/banner/dismiss/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiError(w, r, http.StatusServiceUnavailable, codeReadOnly, "the site is in read-only mode and is not accepting changes", nil)
+			return
+		}
+
+		app.render(w, r, http.StatusServiceUnavailable, "readonly.tmpl.html", app.newTemplateDate(r))
+	})
+}
+
+// Require HTTP basic auth with the admin credentials. State-changing
+// requests must also come from this site, since browsers replay basic
+// auth credentials on cross-site form posts.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.authorize(r, actionManageSite, nil) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="snippety admin", charset="UTF-8"`)
+			app.clientError(w, http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIAdmin is requireAdmin for the JSON API: the same credentials,
+// but failures are reported with the API error envelope.
+func (app *application) requireAPIAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.authorize(r, actionManageSite, nil) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="snippety admin", charset="UTF-8"`)
+			app.apiError(w, r, http.StatusUnauthorized, codeUnauthorized, "valid admin credentials are required", nil)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// minifyHTML buffers HTML responses and minifies them before sending. It
+// is a no-op unless -minify-html is set.
+func (app *application) minifyHTML(next http.Handler) http.Handler {
+	if !app.minify {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := &minifyWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(mw, r)
+		mw.flush()
+	})
+}
+
+// minifyWriter holds back the body of HTML responses until the handler
+// returns. Anything else is passed straight through. Handlers often call
+// WriteHeader before the Content-Type is known, so the decision is made on
+// the first Write.
+type minifyWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	decided     bool
+	html        bool
+	buf         bytes.Buffer
+}
+
+func (mw *minifyWriter) WriteHeader(status int) {
+	if !mw.wroteHeader {
+		mw.wroteHeader = true
+		mw.status = status
+	}
+}
+
+func (mw *minifyWriter) Write(b []byte) (int, error) {
+	if !mw.decided {
+		mw.decide(b)
+	}
+	if mw.html {
+		return mw.buf.Write(b)
+	}
+	return mw.ResponseWriter.Write(b)
+}
+
+func (mw *minifyWriter) decide(b []byte) {
+	mw.decided = true
+
+	h := mw.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(b))
+	}
+	mw.html = strings.HasPrefix(h.Get("Content-Type"), "text/html") && h.Get("Content-Encoding") == ""
+
+	if !mw.html {
+		mw.ResponseWriter.WriteHeader(mw.status)
+	}
+}
+
+func (mw *minifyWriter) flush() {
+	switch {
+	case !mw.decided:
+		// No body was written.
+		if mw.wroteHeader {
+			mw.ResponseWriter.WriteHeader(mw.status)
+		}
+		return
+	case !mw.html:
+		return
+	}
+
+	body := minify.HTML(mw.buf.Bytes())
+	mw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	mw.ResponseWriter.WriteHeader(mw.status)
+	mw.ResponseWriter.Write(body)
+}
+
+func (mw *minifyWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// statusWriter remembers the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// accessLog writes a line per request in the Apache combined log format
+// when -access-log is set, for tools such as GoAccess and AWStats:
+//
+//	127.0.0.1 - admin [16/Oct/2026:13:55:36 +0000] "GET /admin HTTP/1.1" 200 2326 "-" "curl/8.5.0"
+//
+// The user is the basic auth username, which is only ever the admin.
+func (app *application) accessLog(next http.Handler) http.Handler {
+	if app.accessLogger == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		user, _, _ := r.BasicAuth()
+		// HEAD bodies are counted by Write but never sent.
+		size := "-"
+		if sw.bytes > 0 && r.Method != http.MethodHead {
+			size = strconv.Itoa(sw.bytes)
+		}
+
+		app.accessLogger.Printf("%s - %s [%s] %s %d %s %s %s",
+			clientIP(r),
+			logField(user),
+			start.Format("02/Jan/2006:15:04:05 -0700"),
+			logQuote(r.Method+" "+loggedURI(r)+" "+r.Proto),
+			sw.status,
+			size,
+			logQuote(cmp.Or(r.Referer(), "-")),
+			logQuote(cmp.Or(r.UserAgent(), "-")),
+		)
+	})
+}
+
+// Return s for an unquoted log field, or "-" if it's empty. Spaces would
+// split the field, so they're escaped.
+func logField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(logEscape(s), " ", `\x20`)
+}
+
+// Quote s for the log, escaping quotes, backslashes and control
+// characters as Apache does, so a request can't forge log lines.
+func logQuote(s string) string {
+	return `"` + logEscape(s) + `"`
+}
+
+func logEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
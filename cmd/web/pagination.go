@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"net/url"
+	"snippety/internal/models"
+	"strconv"
+)
+
+// Pagination holds everything the "pagination" partial needs to render
+// page controls. Links keep the request's other query parameters.
+type Pagination struct {
+	Page     int
+	PerPage  int
+	Total    int
+	LastPage int
+	PrevURL  string
+	NextURL  string
+	Pages    []PageLink
+}
+
+// PageLink is one entry in the list of page numbers. Gap entries stand for
+// a run of omitted pages and have no number or URL.
+type PageLink struct {
+	Number  int
+	URL     string
+	Current bool
+	Gap     bool
+}
+
+// Number of pages shown either side of the current one.
+const pageWindow = 2
+
+// Read the 1-based page number from the page query parameter. A missing
+// parameter means page 1.
+func pageParam(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("page")
+	if v == "" {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(v)
+	if err != nil || page < 1 {
+		return 0, strconv.ErrSyntax
+	}
+	return page, nil
+}
+
+// Build the pagination for the given page of total items.
+func newPagination(r *http.Request, page, perPage, total int) Pagination {
+	p := Pagination{
+		Page:     page,
+		PerPage:  perPage,
+		Total:    total,
+		LastPage: max(1, (total+perPage-1)/perPage),
+	}
+
+	if page > 1 {
+		p.PrevURL = pageURL(r, page-1)
+	}
+	if page < p.LastPage {
+		p.NextURL = pageURL(r, page+1)
+	}
+
+	for n := 1; n <= p.LastPage; n++ {
+		near := n >= page-pageWindow && n <= page+pageWindow
+		if n != 1 && n != p.LastPage && !near {
+			if last := len(p.Pages) - 1; last < 0 || !p.Pages[last].Gap {
+				p.Pages = append(p.Pages, PageLink{Gap: true})
+			}
+			continue
+		}
+		p.Pages = append(p.Pages, PageLink{Number: n, URL: pageURL(r, n), Current: n == page})
+	}
+
+	return p
+}
+
+// Offset of the first item on the page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Load the page of snippets selected by the page query parameter, with
+// opts.Limit items per page. It writes an error response and returns false
+// if the page doesn't exist or the query fails.
+func (app *application) listPage(w http.ResponseWriter, r *http.Request, opts models.SnippetListOptions) ([]models.Snippet, *Pagination, bool) {
+	page, err := pageParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	total, err := app.snippets.Count(opts)
+	if errors.Is(err, models.ErrUnavailable) && page == 1 {
+		// List can still serve the first page from its outage cache, so
+		// show that without page controls.
+		snippets, err := app.snippets.List(opts)
+		if err != nil {
+			app.serverError(w, r, err)
+			return nil, nil, false
+		}
+		return snippets, nil, true
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, nil, false
+	}
+
+	opts.Limit = cmp.Or(opts.Limit, models.DefaultListLimit)
+	p := newPagination(r, page, opts.Limit, total)
+	if page > p.LastPage {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+
+	opts.Offset = p.Offset()
+	snippets, err := app.snippets.List(opts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, nil, false
+	}
+
+	return snippets, &p, true
+}
+
+// Return the request's path and query with the page parameter replaced.
+// Page 1 drops the parameter so the first page has a single URL.
+func pageURL(r *http.Request, page int) string {
+	q := r.URL.Query()
+	if page == 1 {
+		q.Del("page")
+	} else {
+		q.Set("page", strconv.Itoa(page))
+	}
+
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
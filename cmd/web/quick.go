@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"snippety/internal/hooks"
+	"snippety/internal/models"
+	"snippety/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quick save is for browser extensions and editor plugins: the request
+// body is the raw text to paste, and the response is the new snippet's
+// URL. Callers authenticate with a bearer token from -quick-save-tokens,
+// which lets them create snippets and nothing else.
+//
+//	curl -H "Authorization: Bearer $TOKEN" --data-binary @main.go \
+//	    "https://snippety.example/api/v1/quick?language=go"
+
+// Split the -quick-save-tokens flag. Empty entries are dropped so a
+// trailing comma doesn't enable an empty token.
+func parseQuickSaveTokens(s string) [][]byte {
+	var tokens [][]byte
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, []byte(t))
+		}
+	}
+	return tokens
+}
+
+// Report whether the request carries one of the quick save tokens.
+func (app *application) hasQuickSaveToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	match := 0
+	for _, t := range app.quickSaveTokens {
+		match |= subtle.ConstantTimeCompare([]byte(token), t)
+	}
+	return match == 1
+}
+
+// Read a raw body of content, which may be sent chunked, cleaning it up
+// with app.content as it arrives. A body over limit is refused as soon as
+// that's known: before reading it if Content-Length says so, or once limit
+// bytes have arrived. The content is built up in a single buffer sized
+// from Content-Length, so a large paste is held once rather than copied
+// for each step.
+func (app *application) readContent(w http.ResponseWriter, r *http.Request, limit int) (string, error) {
+	if r.ContentLength > int64(limit) {
+		return "", &http.MaxBytesError{Limit: int64(limit)}
+	}
+
+	var b strings.Builder
+	if r.ContentLength > 0 {
+		b.Grow(int(r.ContentLength))
+	}
+	nw := app.content.normalizer(&b)
+	_, err := io.Copy(nw, http.MaxBytesReader(w, r.Body, int64(limit)))
+	nw.Close()
+	return b.String(), err
+}
+
+// Create a snippet from the raw request body. The title, language and
+// expires query parameters are optional; the title defaults to the
+// content's first non-blank line and the expiry to -default-expiry.
+// Parameters named meta.<key> become metadata, such as
+// meta.ci_job=https://ci.example/jobs/42.
+func (app *application) apiQuickSave(w http.ResponseWriter, r *http.Request) {
+	if !app.authorize(r, actionQuickSave, nil) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="snippety"`)
+		app.apiError(w, r, http.StatusUnauthorized, codeUnauthorized, "a valid quick save token is required", nil)
+		return
+	}
+
+	content, err := app.readContent(w, r, app.content.maxBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.apiError(w, r, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("body must not be larger than %d bytes", app.content.maxBytes), nil)
+			return
+		}
+		app.apiBadRequest(w, r, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	title := query.Get("title")
+	if title == "" {
+		title = defaultTitle(content)
+	}
+	language := query.Get("language")
+
+	expires := app.expiry.defaultDays
+	if s := query.Get("expires"); s != "" {
+		expires, err = strconv.Atoi(s)
+		if err != nil {
+			app.apiFailedValidation(w, r, map[string]string{"expires": "must be a number of days"})
+			return
+		}
+	}
+
+	var metadata models.Metadata
+	for name, values := range query {
+		if key, ok := strings.CutPrefix(name, "meta."); ok {
+			if metadata == nil {
+				metadata = models.Metadata{}
+			}
+			metadata[key] = values[0]
+		}
+	}
+
+	var v validator.Validator
+	draft := hooks.Draft{Title: title, Content: content, Language: language}
+	if err := filterDraft(&v, &draft); err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	title, content, language = draft.Title, draft.Content, draft.Language
+
+	validateSnippet(&v, title, content, language, app.content.maxBytes)
+	validateMetadata(&v, metadata)
+	validateExpiry(&v, expires, app.expiry.choices())
+	if !v.Valid() {
+		app.apiFailedValidation(w, r, v.FieldErrors)
+		return
+	}
+
+	id, err := app.snippets.Insert(title, content, language, metadata, expires, app.expiry.policy, time.Time{})
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.snippetCreated(id, title, time.Time{})
+
+	url := app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", id))
+	headers := make(http.Header)
+	headers.Set("Location", url)
+
+	err = app.writeJSON(w, http.StatusCreated, map[string]any{"id": id, "url": url}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// Use the first non-blank line of content as its title, cut to fit.
+func defaultTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return models.Truncate(line, models.MaxTitleChars-1)
+		}
+	}
+	return "Untitled"
+}
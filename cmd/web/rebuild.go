@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"snippety/internal/search"
+	"time"
+)
+
+// What POST /admin/rebuild/{target} and the rebuild command can rebuild,
+// for recovering from drift without a restart:
+//
+//	templates  parse the templates again, picking up edits to ui/html
+//	           and the theme
+//	search     rebuild the search index from the snippets table
+//	caches     drop the cached stats, banners, suggestions, widget and
+//	           the listings kept for database outages
+//	counters   write out buffered page views and count snippets and
+//	           views for the stats page afresh
+const (
+	rebuildTemplates = "templates"
+	rebuildSearch    = "search"
+	rebuildCaches    = "caches"
+	rebuildCounters  = "counters"
+)
+
+var errNoSearchIndex = errors.New("the sql search backend has no index to rebuild")
+
+// Targets that can be rebuilt with the current configuration.
+func (app *application) rebuildTargets() []string {
+	targets := []string{rebuildTemplates}
+	if _, ok := app.search.(search.Rebuilder); ok {
+		targets = append(targets, rebuildSearch)
+	}
+	return append(targets, rebuildCaches, rebuildCounters)
+}
+
+// Parse the templates again and swap them in. The running templates are
+// kept if any fail to parse.
+func (app *application) reloadTemplates() error {
+	cache, err := newTemplateCache(app.assets, app.themeDir)
+	if err != nil {
+		return err
+	}
+
+	app.templateMu.Lock()
+	app.templateCache = cache
+	app.templateMu.Unlock()
+	return nil
+}
+
+func (app *application) template(page string) (*template.Template, bool) {
+	app.templateMu.RLock()
+	defer app.templateMu.RUnlock()
+
+	ts, ok := app.templateCache[page]
+	return ts, ok
+}
+
+func (app *application) rebuildSearchIndex() error {
+	index, ok := app.search.(search.Rebuilder)
+	if !ok {
+		return errNoSearchIndex
+	}
+	return index.Rebuild()
+}
+
+// Forget everything cached from the database, so the next requests load
+// it afresh.
+func (app *application) clearCaches() {
+	app.invalidateBanners()
+	app.invalidateStats()
+
+	app.suggestCache.mu.Lock()
+	app.suggestCache.entries = nil
+	app.suggestCache.mu.Unlock()
+
+	app.invalidateWidget()
+
+	if c, ok := app.snippets.(cacheClearer); ok {
+		c.ClearCache()
+	}
+}
+
+// Implemented by snippet models that keep listings to serve through an
+// outage.
+type cacheClearer interface {
+	ClearCache()
+}
+
+func (app *application) invalidateStats() {
+	app.statsCache.mu.Lock()
+	app.statsCache.fetched = time.Time{}
+	app.statsCache.viewsFetched = time.Time{}
+	app.statsCache.mu.Unlock()
+}
+
+// Write out buffered page views, unless the site is read-only, then count
+// everything on the stats page again, so it's current at once and any
+// failure is reported rather than covered by stale numbers.
+func (app *application) recount() error {
+	if !app.readOnly.Load() {
+		if err := app.flushPageViewsOnce(); err != nil {
+			return err
+		}
+	}
+
+	app.invalidateStats()
+	if _, err := app.snippetStats(); err != nil {
+		return err
+	}
+	_, err := app.pageViewsPerDay()
+	return err
+}
+
+// Rebuild one target. Rebuilding the search index can take a while, so
+// it's queued as a background job and runs after this returns.
+func (app *application) adminRebuildPost(w http.ResponseWriter, r *http.Request) {
+	target := r.PathValue("target")
+
+	var err error
+	switch target {
+	case rebuildTemplates:
+		err = app.reloadTemplates()
+	case rebuildSearch:
+		if _, ok := app.search.(search.Rebuilder); !ok {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		err = app.jobs.Enqueue(jobRebuildIndex, nil)
+	case rebuildCaches:
+		app.clearCaches()
+	case rebuildCounters:
+		err = app.recount()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("rebuild requested", slog.String("target", target))
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// The rebuild command. Caches and counters only exist inside a running
+// server, so from the command line templates are just checked, which is
+// useful before rebuilding them on the server.
+func (app *application) rebuildCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: rebuild %s|%s|%s|%s", rebuildTemplates, rebuildSearch, rebuildCaches, rebuildCounters)
+	}
+
+	switch args[0] {
+	case rebuildTemplates:
+		if err := app.reloadTemplates(); err != nil {
+			return err
+		}
+		app.logger.Info("templates parsed")
+	case rebuildSearch:
+		if err := app.rebuildSearchIndex(); err != nil {
+			return err
+		}
+		app.logger.Info("rebuilt search index")
+	case rebuildCaches:
+		return errors.New("caches are kept by the running server; use POST /admin/rebuild/caches")
+	case rebuildCounters:
+		return errors.New("counters are kept by the running server; use POST /admin/rebuild/counters")
+	default:
+		return fmt.Errorf("unknown rebuild target %q", args[0])
+	}
+	return nil
+}
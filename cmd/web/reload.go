@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings that can change without a restart. They are read from the
+// -settings file at startup, overriding the matching flags, and again on
+// SIGHUP or POST /admin/reload. Keys missing from the file keep their
+// current value. For example:
+//
+//	log_level: info
+//	maintenance: false
+//	read_only: false
+//	analytics: true
+//	suggest_rate: 5
+//	suggest_burst: 20
+type reloadableSettings struct {
+	LogLevel     *string  `yaml:"log_level"`
+	Maintenance  *bool    `yaml:"maintenance"`
+	ReadOnly     *bool    `yaml:"read_only"`
+	Analytics    *bool    `yaml:"analytics"`
+	SuggestRate  *float64 `yaml:"suggest_rate"`
+	SuggestBurst *float64 `yaml:"suggest_burst"`
+}
+
+func readSettings(path string) (reloadableSettings, error) {
+	var s reloadableSettings
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Re-read the settings file and apply it, and drop the banner cache so
+// banner changes show up straight away. Nothing is applied if any value
+// is invalid.
+func (app *application) reloadSettings() error {
+	app.invalidateBanners()
+
+	if app.settingsPath == "" {
+		return nil
+	}
+
+	s, err := readSettings(app.settingsPath)
+	if err != nil {
+		return err
+	}
+
+	var level slog.Level
+	if s.LogLevel != nil {
+		if err := level.UnmarshalText([]byte(*s.LogLevel)); err != nil {
+			return fmt.Errorf("%s: log_level: %w", app.settingsPath, err)
+		}
+	}
+	rate, burst := app.suggestLimiter.limits()
+	if s.SuggestRate != nil {
+		rate = *s.SuggestRate
+	}
+	if s.SuggestBurst != nil {
+		burst = *s.SuggestBurst
+	}
+	if rate <= 0 || burst < 1 {
+		return fmt.Errorf("%s: suggest_rate must be positive and suggest_burst at least 1", app.settingsPath)
+	}
+
+	if s.LogLevel != nil {
+		app.logLevel.Set(level)
+	}
+	if s.Maintenance != nil {
+		app.maintenance.Store(*s.Maintenance)
+	}
+	if s.ReadOnly != nil {
+		app.readOnly.Store(*s.ReadOnly)
+	}
+	if s.Analytics != nil {
+		app.analytics.Store(*s.Analytics)
+	}
+	app.suggestLimiter.setLimits(rate, burst)
+
+	app.logger.Info("settings reloaded",
+		slog.String("path", app.settingsPath),
+		slog.String("log_level", app.logLevel.Level().String()),
+		slog.Bool("maintenance", app.maintenance.Load()),
+		slog.Bool("read_only", app.readOnly.Load()),
+		slog.Bool("analytics", app.analytics.Load()),
+		slog.Float64("suggest_rate", rate),
+		slog.Float64("suggest_burst", burst),
+	)
+	return nil
+}
+
+// Reload settings whenever the process gets SIGHUP. A bad file is logged
+// and the running settings are kept.
+func (app *application) reloadOnSIGHUP() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		if err := app.reloadSettings(); err != nil {
+			app.logger.Error("reloading settings failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (app *application) adminReloadPost(w http.ResponseWriter, r *http.Request) {
+	if err := app.reloadSettings(); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
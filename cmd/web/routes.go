@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"snippety/internal/hooks"
 
 	"github.com/justinas/alice"
 )
@@ -9,15 +10,95 @@ import (
 func (app *application) routes() http.Handler {
 	mux := http.NewServeMux()
 
-	fileServer := http.FileServer(http.Dir("ui/static/"))
-	mux.Handle("GET /static/", http.StripPrefix("/static", fileServer))
+	mux.Handle("GET /static/", http.StripPrefix("/static", app.assets.handler()))
+
+	mux.HandleFunc("GET /healthz", app.healthz)
 
 	mux.HandleFunc("GET /{$}", app.home)
 	mux.HandleFunc("GET /snippet/view/{id}", app.snippetView)
-	mux.HandleFunc("GET /snippet/create", app.snippetCreateForm)
+	mux.HandleFunc("GET /snippet/format/{id}", app.snippetFormat)
+	mux.HandleFunc("GET /snippet/print/{id}", app.snippetPrint)
+	mux.HandleFunc("GET /snippet/raw/{id}", app.snippetRaw)
+	mux.HandleFunc("GET /snippet/markdown/{id}", app.snippetExportMarkdown)
+	mux.HandleFunc("GET /snippet/pdf/{id}", app.snippetExportPDF)
+	mux.HandleFunc("GET /share/{id}", app.snippetShared)
+	mux.HandleFunc("GET /compare/{idA}/{idB}", app.snippetCompare)
+	mux.HandleFunc("GET /search", app.snippetSearch)
+	mux.HandleFunc("GET /stats", app.stats)
+	mux.HandleFunc("GET /feed.json", app.feedJSON)
+	mux.HandleFunc("POST /banner/dismiss/{id}", app.bannerDismissPost)
+	mux.HandleFunc("GET /snippet/create", app.snippetCreate)
 	mux.HandleFunc("POST /snippet/create", app.snippetCreatePost)
 
-	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
+	mux.HandleFunc("GET /api/v1/version", app.apiVersion)
+	mux.HandleFunc("GET /api/v1/snippets", app.apiSnippetList)
+	mux.HandleFunc("GET /api/v1/snippets/{id}", app.apiSnippetView)
+	mux.HandleFunc("GET /api/v1/snippets/{id}/formatted", app.apiSnippetFormatted)
+	mux.HandleFunc("GET /api/v1/compare/{idA}/{idB}", app.apiSnippetCompare)
+	mux.HandleFunc("GET /api/v1/stats/languages", app.apiLanguageStats)
+	mux.HandleFunc("GET /api/v1/widgets/latest", app.apiWidgetLatest)
+	mux.Handle("GET /api/v1/search/suggest", alice.New(app.rateLimit(app.suggestLimiter)).ThenFunc(app.apiSearchSuggest))
+	mux.HandleFunc("POST /api/v1/snippets", app.apiSnippetCreate)
+	mux.HandleFunc("POST /api/v1/quick", app.apiQuickSave)
+	mux.HandleFunc("/api/", app.apiFallback(mux))
+
+	admin := alice.New(app.requireAdmin)
+
+	mux.Handle("GET /metrics", admin.ThenFunc(app.metrics))
+	mux.Handle("GET /admin", admin.ThenFunc(app.adminHome))
+	mux.Handle("GET /admin/analytics", admin.ThenFunc(app.adminAnalytics))
+	mux.Handle("GET /admin/activity", admin.ThenFunc(app.adminActivity))
+	mux.Handle("GET /admin/analytics/creations", admin.ThenFunc(app.adminAnalyticsCreations))
+	mux.Handle("POST /admin/maintenance", admin.ThenFunc(app.adminMaintenancePost))
+	mux.Handle("POST /admin/read-only", admin.ThenFunc(app.adminReadOnlyPost))
+	mux.Handle("POST /admin/reload", admin.ThenFunc(app.adminReloadPost))
+	mux.Handle("POST /admin/rebuild/{target}", admin.ThenFunc(app.adminRebuildPost))
+	mux.Handle("POST /admin/banners", admin.ThenFunc(app.adminBannerCreatePost))
+	mux.Handle("POST /admin/banners/{id}/delete", admin.ThenFunc(app.adminBannerDeletePost))
+	mux.Handle("GET /admin/templates", admin.ThenFunc(app.adminTemplates))
+	mux.Handle("POST /admin/templates", admin.ThenFunc(app.adminTemplateCreatePost))
+	mux.Handle("GET /admin/templates/{id}", admin.ThenFunc(app.adminTemplateEdit))
+	mux.Handle("POST /admin/templates/{id}", admin.ThenFunc(app.adminTemplateUpdatePost))
+	mux.Handle("POST /admin/templates/{id}/delete", admin.ThenFunc(app.adminTemplateDeletePost))
+	mux.Handle("POST /snippet/expires/{id}", admin.ThenFunc(app.snippetExpiresPost))
+	mux.Handle("GET /snippet/share/{id}", admin.ThenFunc(app.snippetShare))
+	mux.Handle("POST /snippet/share/{id}/revoke", admin.ThenFunc(app.snippetShareRevokePost))
+	mux.Handle("PATCH /api/v1/snippets/{id}", alice.New(app.requireAPIAdmin).ThenFunc(app.apiSnippetUpdate))
+
+	for _, route := range hooks.Routes() {
+		if route.Admin {
+			mux.Handle(route.Pattern, admin.Then(route.Handler))
+		} else {
+			mux.Handle(route.Pattern, route.Handler)
+		}
+	}
+
+	standard := alice.New(app.realIP, app.accessLog, app.recoverPanic, app.checkHost, app.logRequest, commonHeaders, app.countPageViews, app.minifyHTML, app.maintenanceMode, app.readOnlyMode)
 
 	return standard.Then(mux)
 }
+
+// Methods tried when working out which a path allows.
+var knownMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Answer API requests no route takes. The catch-all matches every method,
+// so the mux never answers 405 itself: if the path is routed for other
+// methods, say so with an Allow header, and otherwise that it's missing.
+func (app *application) apiFallback(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var allow []string
+		for _, method := range knownMethods {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if _, pattern := mux.Handler(probe); pattern != "/api/" {
+				allow = append(allow, method)
+			}
+		}
+
+		if len(allow) > 0 {
+			app.apiMethodNotAllowed(w, r, allow)
+			return
+		}
+		app.apiNotFound(w, r)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"snippety/internal/secrets"
+	"strings"
+)
+
+// Flags whose values are secret, or contain one. They are redacted when
+// the configuration is printed, and may be given as a secrets reference
+// such as file:/run/secrets/dsn or vault:secret/data/snippety#dsn.
+var secretFlags = map[string]bool{
+	"admin-password":    true,
+	"share-secret":      true,
+	"form-secret":       true,
+	"quick-save-tokens": true,
+	"dsn":               true,
+	"read-dsn":          true,
+	"sentry-dsn":        true,
+	"error-webhook":     true,
+	"alert-webhook":     true,
+}
+
+// Replace secret flag values that are references with what they refer
+// to. A secret flag left unset on the command line is read from the file
+// named by its _FILE environment variable if there is one, such as
+// SNIPPETY_DSN_FILE for -dsn, following the Docker secrets convention.
+func resolveSecretFlags(r *secrets.Resolver) error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for name := range secretFlags {
+		ref := flag.Lookup(name).Value.String()
+		if !set[name] {
+			if path := os.Getenv(secretFileEnv(name)); path != "" {
+				ref = "file:" + path
+			}
+		}
+
+		value, err := r.Resolve(context.Background(), ref)
+		if err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func secretFileEnv(flagName string) string {
+	return "SNIPPETY_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_")) + "_FILE"
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Share links let anyone holding them view a snippet before it's
+// published, until the link expires. The URL carries its expiry and an
+// HMAC over the snippet id, expiry and the snippet's share generation.
+// Revoking a snippet's links bumps its generation, which invalidates them
+// all; changing -share-secret revokes every link at once. The signature
+// is kept out of logs; see loggedURI.
+//
+//	/share/12?expires=1760601600&sig=...
+
+// Longest a share link can be valid for.
+const maxShareDuration = 30 * 24 * time.Hour
+
+func (app *application) shareSignature(id, generation int, expires time.Time) string {
+	mac := hmac.New(sha256.New, app.shareSecret)
+	fmt.Fprintf(mac, "snippet:%d:%d:%d", id, generation, expires.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (app *application) shareURL(r *http.Request, id int, expires time.Time) (string, error) {
+	generation, err := app.shares.Generation(id)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", app.shareSignature(id, generation, expires))
+	return app.absoluteURL(r, fmt.Sprintf("/share/%d?%s", id, q.Encode())), nil
+}
+
+// Report whether the request carries a valid, unexpired and unrevoked
+// share link for snippet id.
+func (app *application) validShare(r *http.Request, id int) (bool, error) {
+	unix, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	expires := time.Unix(unix, 0)
+	if !time.Now().Before(expires) {
+		return false, nil
+	}
+
+	generation, err := app.shares.Generation(id)
+	if err != nil {
+		return false, err
+	}
+	want := app.shareSignature(id, generation, expires)
+	return hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(want)), nil
+}
+
+// Create a share link valid for the number of hours in the hours query
+// parameter and show it on the snippet's page.
+func (app *application) snippetShare(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	hours, err := strconv.Atoi(r.URL.Query().Get("hours"))
+	if err != nil || hours < 1 || time.Duration(hours)*time.Hour > maxShareDuration {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	expires := time.Now().Add(time.Duration(hours) * time.Hour).Truncate(time.Second)
+	shareURL, err := app.shareURL(r, id, expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.Snippet = snippet
+	data.ShareURL = shareURL
+	data.ShareExpires = expires
+
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+// Show a snippet through a share link, whether or not it's published.
+func (app *application) snippetShared(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	valid, err := app.validShare(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !valid {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Keep the link out of caches, search engines and Referer headers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	data := app.newTemplateDate(r)
+	data.Snippet = snippet
+
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+// Revoke every share link made so far for a snippet.
+func (app *application) snippetShareRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if _, err := app.snippets.Get(id); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if _, err := app.shares.Revoke(id); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("revoked share links", slog.Int("id", id))
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// The request's URI as it should be logged, with share link signatures
+// replaced so logs don't hand out access to unpublished snippets.
+func loggedURI(r *http.Request) string {
+	q := r.URL.Query()
+	if !q.Has("sig") {
+		return r.URL.RequestURI()
+	}
+	q.Set("sig", "REDACTED")
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
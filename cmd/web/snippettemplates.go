@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"snippety/internal/models"
+	"snippety/internal/validator"
+	"strconv"
+)
+
+// Snippet templates are boilerplates, such as a bug report skeleton, that
+// a new snippet can start from. The admin manages them at
+// /admin/templates, and the create page offers them in a picker that
+// reloads the page with ?template=<id> to fill in the form.
+
+// templateForm holds a template being created or edited, so it can be
+// shown again with any errors. ID is zero for a new template.
+type templateForm struct {
+	ID       int
+	Name     string
+	Title    string
+	Content  string
+	Language string
+	validator.Validator
+}
+
+func (app *application) readTemplateForm(r *http.Request) (templateForm, error) {
+	if err := r.ParseForm(); err != nil {
+		return templateForm{}, err
+	}
+
+	form := templateForm{
+		Name:     r.PostForm.Get("name"),
+		Title:    r.PostForm.Get("title"),
+		Content:  app.content.normalize(r.PostForm.Get("content")),
+		Language: r.PostForm.Get("language"),
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "must be provided")
+	form.CheckField(validator.MaxChars(form.Name, models.MaxTemplateNameChars), "name", fmt.Sprintf("must not be more than %d characters long", models.MaxTemplateNameChars))
+	// The title may be left for whoever uses the template to fill in.
+	form.CheckField(validator.MaxChars(form.Title, models.MaxTitleChars), "title", fmt.Sprintf("must not be more than %d characters long", models.MaxTitleChars))
+	validateContent(&form.Validator, form.Content, app.content.maxBytes)
+	validateLanguage(&form.Validator, form.Language)
+
+	return form, nil
+}
+
+// Show the templates page: every template, and the form for a new one or
+// the one being edited.
+func (app *application) renderTemplates(w http.ResponseWriter, r *http.Request, status int, form templateForm) {
+	templates, err := app.snippetTemplates.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateDate(r)
+	data.SnippetTemplates = templates
+	data.Form = form
+	data.Languages = snippetLanguages()
+
+	app.render(w, r, status, "templates.tmpl.html", data)
+}
+
+func (app *application) adminTemplates(w http.ResponseWriter, r *http.Request) {
+	app.renderTemplates(w, r, http.StatusOK, templateForm{})
+}
+
+func (app *application) adminTemplateEdit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	t, err := app.snippetTemplates.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.renderTemplates(w, r, http.StatusOK, templateForm{ID: t.ID, Name: t.Name, Title: t.Title, Content: t.Content, Language: t.Language})
+}
+
+func (app *application) adminTemplateCreatePost(w http.ResponseWriter, r *http.Request) {
+	form, err := app.readTemplateForm(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if !form.Valid() {
+		app.renderTemplates(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.snippetTemplates.Insert(form.Name, form.Title, form.Content, form.Language)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+}
+
+func (app *application) adminTemplateUpdatePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	form, err := app.readTemplateForm(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.ID = id
+	if !form.Valid() {
+		app.renderTemplates(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	err = app.snippetTemplates.Update(id, form.Name, form.Title, form.Content, form.Language)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+}
+
+func (app *application) adminTemplateDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.snippetTemplates.Delete(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+}
+
+// Fill in a new snippet from the template named by the template query
+// parameter, if there is one. An unknown template is ErrNoRecord.
+func (app *application) startFromTemplate(r *http.Request, form *snippetCreateForm) (int, error) {
+	s := r.URL.Query().Get("template")
+	if s == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 {
+		return 0, models.ErrNoRecord
+	}
+
+	t, err := app.snippetTemplates.Get(id)
+	if err != nil {
+		return 0, err
+	}
+
+	form.Title, form.Content, form.Language = t.Title, t.Content, t.Language
+	return id, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"snippety/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Search-as-you-type sends a request per keystroke, so suggestions are
+// cached per query for a short while and each client is rate limited.
+const (
+	maxSuggestions   = 8
+	suggestCacheTTL  = time.Minute
+	suggestCacheSize = 1000
+	// Sustained suggestion requests per second per client, and the burst
+	// allowed on top, unless the -settings file says otherwise.
+	suggestRate  = 5
+	suggestBurst = 20
+)
+
+type suggestCache struct {
+	mu      sync.Mutex
+	entries map[string]suggestEntry
+}
+
+type suggestEntry struct {
+	suggestions []models.Suggestion
+	fetched     time.Time
+}
+
+func (app *application) suggestTitles(prefix string) ([]models.Suggestion, error) {
+	key := strings.ToLower(prefix)
+
+	c := &app.suggestCache
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetched) < suggestCacheTTL {
+		return e.suggestions, nil
+	}
+
+	suggestions, err := app.snippets.SuggestTitles(prefix, maxSuggestions)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// Start over rather than track recency; a full cache is rebuilt in a
+	// minute anyway.
+	if c.entries == nil || len(c.entries) >= suggestCacheSize {
+		c.entries = map[string]suggestEntry{}
+	}
+	c.entries[key] = suggestEntry{suggestions, time.Now()}
+	c.mu.Unlock()
+
+	return suggestions, nil
+}
+
+type apiSuggestion struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Suggest snippet titles starting with, or containing a word starting
+// with, the q query parameter.
+func (app *application) apiSearchSuggest(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > models.MaxTitleChars {
+		app.apiFailedValidation(w, r, map[string]string{"q": "must be between 1 and " + strconv.Itoa(models.MaxTitleChars) + " characters"})
+		return
+	}
+
+	suggestions, err := app.suggestTitles(q)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	out := make([]apiSuggestion, len(suggestions))
+	for i, s := range suggestions {
+		out[i] = apiSuggestion{ID: s.ID, Title: s.Title, URL: "/snippet/view/" + strconv.Itoa(s.ID)}
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=60")
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"suggestions": out}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// rateLimiter is a token bucket per client IP.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	clients map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, clients: map[string]*bucket{}}
+}
+
+func (l *rateLimiter) limits() (rate, burst float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate, l.burst
+}
+
+// Change the limits for every client. Buckets keep their tokens, capped at
+// the new burst.
+func (l *rateLimiter) setLimits(rate, burst float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = rate, burst
+}
+
+// Take a token for key, or report how long until one is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.clients[key]
+	if !ok {
+		// Drop clients whose buckets have refilled, so the map doesn't
+		// grow with every address ever seen.
+		if len(l.clients) >= 10000 {
+			for k, b := range l.clients {
+				if now.Sub(b.last).Seconds()*l.rate >= l.burst {
+					delete(l.clients, k)
+				}
+			}
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Reject API requests from clients over l's rate with a 429.
+func (app *application) rateLimit(l *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := l.allow(clientIP(r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				app.apiError(w, r, http.StatusTooManyRequests, codeRateLimited, "too many requests, please slow down", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"snippety/internal/models"
+	"strconv"
+	"time"
+)
+
+type apiDeletion struct {
+	ID        int       `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Answer GET /api/v1/snippets?updated_since=<RFC 3339 time> with the
+// snippets changed since then and the ids of those that have gone, so
+// offline clients can sync without downloading everything again.
+//
+// Changes come a page at a time, up to limit of them. While the response
+// has a next_cursor, pass it as cursor, with the same updated_since, for
+// the next page. Once it has none, pass synced_at as updated_since next
+// time.
+func (app *application) apiSnippetChanges(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	since, err := time.Parse(time.RFC3339, qs.Get("updated_since"))
+	if err != nil {
+		app.apiFailedValidation(w, r, map[string]string{"updated_since": "must be an RFC 3339 time, such as 2026-01-02T15:04:05Z"})
+		return
+	}
+
+	opts := models.ChangesOptions{Since: since}
+	if v := qs.Get("limit"); v != "" {
+		opts.Limit, err = strconv.Atoi(v)
+		if err != nil || opts.Limit < 1 {
+			app.apiBadRequest(w, r, "limit must be a positive integer")
+			return
+		}
+	}
+	if v := qs.Get("cursor"); v != "" {
+		opts.Until, opts.After, err = parseChangesCursor(v)
+		if err != nil {
+			app.apiBadRequest(w, r, "cursor must be a next_cursor from an earlier response")
+			return
+		}
+	}
+
+	changes, err := app.snippets.Changes(opts)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	deleted := make([]apiDeletion, len(changes.Expired))
+	for i, s := range changes.Expired {
+		deleted[i] = apiDeletion{ID: s.ID, DeletedAt: s.Expires}
+	}
+
+	body := map[string]any{
+		"snippets":  toAPISnippets(changes.Updated),
+		"deleted":   deleted,
+		"synced_at": changes.Until,
+	}
+	if changes.More {
+		body["next_cursor"] = changesCursor(changes.Until, changes.Last)
+	}
+	err = app.writeJSON(w, http.StatusOK, body, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// Encode the end of a sync's window and the last change sent, so the
+// next page carries on from there. Clients treat it as opaque.
+func changesCursor(until time.Time, last models.ChangePosition) string {
+	s := fmt.Sprintf("%d.%d.%d", until.Unix(), last.At.Unix(), last.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func parseChangesCursor(cursor string) (time.Time, models.ChangePosition, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, models.ChangePosition{}, err
+	}
+
+	var until, at int64
+	var id int
+	if n, err := fmt.Sscanf(string(b), "%d.%d.%d", &until, &at, &id); err != nil || n != 3 {
+		return time.Time{}, models.ChangePosition{}, errors.New("malformed cursor")
+	}
+	return time.Unix(until, 0).UTC(), models.ChangePosition{At: time.Unix(at, 0).UTC(), ID: id}, nil
+}
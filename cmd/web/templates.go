@@ -1,9 +1,21 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"os"
 	"path/filepath"
+	"slices"
+	"snippety/internal/diff"
+	"snippety/internal/format"
+	"snippety/internal/hooks"
 	"snippety/internal/models"
-	"text/template"
+	"snippety/internal/pdf"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,21 +23,164 @@ type templateData struct {
 	CurrentYear int
 	Snippet     models.Snippet
 	Snippets    []models.Snippet
+	Query       string
+	Maintenance bool
+	ReadOnly    bool
+	Banners     []models.Banner
+	AllBanners  []models.Banner
+	Pagination  *Pagination
+	// Submitted form values and their FieldErrors, for re-rendering a form
+	// after validation fails. See the "fieldError" partial.
+	Form any
+	// Absolute URL of the current page, or empty when the host it would
+	// be built from can't be trusted; see hostTrusted.
+	CanonicalURL string
+	// Per-request Content-Security-Policy nonce. Inline <script> and
+	// <style> elements need nonce="{{.CSPNonce}}" to run.
+	CSPNonce string
+	// The request carries admin credentials, which stand in for snippet
+	// ownership until there are user accounts.
+	IsAdmin       bool
+	MaxExpiryDays int
+	// Expiries a new snippet can be given; see expiryOptions.choices.
+	Expiries []int
+	// Expired snippets are archived rather than hidden; see -expiry-mode.
+	ArchiveExpired bool
+	// Which snippets the admin listing shows: "", live or expired.
+	ListStatus string
+	// Options for the language select on the create page.
+	Languages []string
+	// Output of the formatter for the format page, or the reason the
+	// snippet couldn't be formatted.
+	Formatted   string
+	FormatError string
+	Comparison  *comparison
+	Stats       *siteStats
+	PageViews   []models.PageViewCount
+	Events      []models.Event
+	DeadJobs    []models.Job
+	// A share link just created for Snippet, shown to the admin.
+	ShareURL     string
+	ShareExpires time.Time
+	// Set when an edit was based on an old version of Snippet, which now
+	// holds the latest one.
+	EditConflict *editConflict
+	// Signed render time for the create form's bot check.
+	FormStarted string
+	// What the admin page offers to rebuild.
+	RebuildTargets []string
+	// Boilerplates offered on the create page, and the one it started
+	// from, if any.
+	SnippetTemplates []models.SnippetTemplate
+	TemplateID       int
+}
+
+// The rejected edit, offered again against the current version.
+type editConflict struct {
+	Version int
+	Days    int
+}
+
+// Stats plus the largest daily counts, which scale the bars. ViewsPerDay
+// is only set while analytics is on.
+type siteStats struct {
+	models.SnippetStats
+	MaxPerDay      int
+	ViewsPerDay    []models.DayCount
+	MaxViewsPerDay int
+}
+
+// Two snippets and the line diff from A to B.
+type comparison struct {
+	A, B     models.Snippet
+	Lines    []diff.Line
+	Inserted int
+	Deleted  int
+}
+
+func newComparison(a, b models.Snippet) *comparison {
+	c := &comparison{A: a, B: b, Lines: diff.Lines(a.Content, b.Content)}
+	c.Inserted, c.Deleted = diff.Count(c.Lines)
+	return c
 }
 
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":     humanDate,
+	"timeUntil":     timeUntil,
+	"expiryLabel":   expiryLabel,
+	"formattable":   format.Supported,
+	"pdfExportable": pdf.Supported,
+	"lines":         lines,
+}
+
+// Split content into lines for templates that number them. A trailing
+// newline doesn't start another line.
+func lines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n"), "\n")
 }
 
 func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
+// Describe the time left until t in the largest whole unit, such as
+// "3 days" or "5 hours", rounded to the nearest.
+func timeUntil(t time.Time) string {
+	d := time.Until(t)
+	switch {
+	case d >= 24*time.Hour:
+		return plural(int(d.Round(24*time.Hour)/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int(d.Round(time.Hour)/time.Hour), "hour")
+	case d >= time.Minute:
+		return plural(int(d.Round(time.Minute)/time.Minute), "minute")
+	}
+	return "less than a minute"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(n) + " " + unit + "s"
+}
+
+// Where the default templates live.
+const templateDir = "./ui/html"
+
+// Build a template set for each page. Any file found under themeDir, laid
+// out like ui/html, is used in place of the default one; the rest fall
+// back to the defaults, so a theme need only contain what it changes.
+// Themes can also add partials, but not pages.
+func newTemplateCache(assets *assets, themeDir string) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
+	// A theme directory that's missing would silently change nothing.
+	if themeDir != "" {
+		info, err := os.Stat(themeDir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("theme %s is not a directory", themeDir)
+		}
+	}
+
+	base, err := themeFile(themeDir, "base.tmpl.html")
+	if err != nil {
+		return nil, err
+	}
+
+	partials, err := themeGlob(themeDir, "partials/*.tmpl.html")
+	if err != nil {
+		return nil, err
+	}
+
 	// Slice of string of all filespaths matching pattern
-	pages, err := filepath.Glob("./ui/html/pages/*.tmpl.html")
+	pages, err := filepath.Glob(filepath.Join(templateDir, "pages/*.tmpl.html"))
 	if err != nil {
 		return nil, err
 	}
@@ -35,14 +190,19 @@ func newTemplateCache() (map[string]*template.Template, error) {
 		// Extract last segment from full path: a/b/x.html -> x.html
 		name := filepath.Base(page)
 
+		page, err = themeFile(themeDir, filepath.Join("pages", name))
+		if err != nil {
+			return nil, err
+		}
+
 		// Parse base
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.tmpl.html")
+		ts, err := template.New(name).Funcs(functions).Funcs(template.FuncMap{"asset": assets.url}).Funcs(hooks.TemplateFuncs()).ParseFiles(base)
 		if err != nil {
 			return nil, err
 		}
 
 		// Parse partials
-		ts, err = ts.ParseGlob("./ui/html/partials/*.tmpl.html")
+		ts, err = ts.ParseFiles(partials...)
 		if err != nil {
 			return nil, err
 		}
@@ -58,3 +218,38 @@ func newTemplateCache() (map[string]*template.Template, error) {
 
 	return cache, nil
 }
+
+// Return the path of the template file at rel, relative to ui/html,
+// preferring the theme's copy.
+func themeFile(themeDir, rel string) (string, error) {
+	if themeDir != "" {
+		path := filepath.Join(themeDir, rel)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return filepath.Join(templateDir, rel), nil
+}
+
+// Return the template files matching pattern, relative to ui/html, from
+// the defaults and the theme, with the theme's copy of any file in both.
+func themeGlob(themeDir, pattern string) ([]string, error) {
+	byName := map[string]string{}
+	for _, dir := range []string{templateDir, themeDir} {
+		if dir == "" {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			byName[filepath.Base(path)] = path
+		}
+	}
+	return slices.Sorted(maps.Values(byName)), nil
+}
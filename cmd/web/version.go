@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, for example:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/web
+//
+// Anything left empty is filled in from the VCS stamp Go embeds in the
+// binary, when there is one. The stamp has no build time, so buildDate
+// falls back to the commit time.
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
+
+func (b buildInfo) String() string {
+	s := "snippety " + b.Version
+	if b.Commit != "" {
+		s += " (" + b.Commit
+		if b.Modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	if b.BuildDate != "" {
+		s += " built " + b.BuildDate
+	}
+	return fmt.Sprintf("%s with %s", s, b.GoVersion)
+}
+
+func (app *application) apiVersion(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, readBuildInfo(), nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"snippety/internal/models"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The latest snippets widget is meant to be fetched by browsers on other
+// sites, so one listing is cached for all of them and only cut to each
+// request's limit.
+const (
+	widgetDefaultItems = 5
+	widgetMaxItems     = 20
+	widgetCacheTTL     = time.Minute
+)
+
+type widgetCache struct {
+	mu       sync.Mutex
+	snippets []models.Snippet
+	fetched  time.Time
+}
+
+type apiWidgetItem struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+func (app *application) latestForWidget() ([]models.Snippet, error) {
+	c := &app.widgetCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetched) < widgetCacheTTL {
+		return c.snippets, nil
+	}
+
+	snippets, err := app.snippets.List(models.SnippetListOptions{Limit: widgetMaxItems})
+	if err != nil {
+		return nil, err
+	}
+
+	c.snippets = snippets
+	c.fetched = time.Now()
+	return snippets, nil
+}
+
+// Drop the cached listing so a new or retitled snippet shows up at once.
+func (app *application) invalidateWidget() {
+	app.widgetCache.mu.Lock()
+	app.widgetCache.fetched = time.Time{}
+	app.widgetCache.mu.Unlock()
+}
+
+// Serve the titles and links of the latest snippets for embedding in a
+// "recent snippets" box on another site. Any origin may read it, and it
+// carries nothing that isn't on the home page.
+func (app *application) apiWidgetLatest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	limit := widgetDefaultItems
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > widgetMaxItems {
+			app.apiFailedValidation(w, r, map[string]string{"limit": fmt.Sprintf("must be a number between 1 and %d", widgetMaxItems)})
+			return
+		}
+		limit = n
+	}
+
+	latest, err := app.latestForWidget()
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	latest = latest[:min(limit, len(latest))]
+
+	items := make([]apiWidgetItem, len(latest))
+	for i, s := range latest {
+		items[i] = apiWidgetItem{Title: s.Title, URL: app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", s.ID))}
+	}
+
+	// Links built from a forged Host mustn't be kept by shared caches.
+	headers := make(http.Header)
+	if app.hostTrusted() {
+		headers.Set("Cache-Control", "public, max-age=60")
+	} else {
+		headers.Set("Cache-Control", "private, max-age=60")
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"snippets": items}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
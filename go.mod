@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/justinas/alice v1.2.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require filippo.io/edwards25519 v1.1.0 // indirect
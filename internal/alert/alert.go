@@ -0,0 +1,115 @@
+// Package alert posts short messages about critical events to a
+// Slack-compatible incoming webhook, rate limited per kind of event so an
+// ongoing problem doesn't flood the channel.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Webhook sends alerts as {"text": "..."}, the payload Slack, Mattermost
+// and Rocket.Chat incoming webhooks accept.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+	// Minimum time between two alerts with the same key. Alerts in between
+	// are counted and mentioned in the next one.
+	Interval time.Duration
+	// Called with errors from sending, which happens in the background.
+	OnError func(error)
+
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+// Alert sends text unless an alert with the same key was sent less than
+// Interval ago. It never blocks.
+func (w *Webhook) Alert(key, text string) {
+	w.mu.Lock()
+	if w.last == nil {
+		w.last = map[string]time.Time{}
+		w.suppressed = map[string]int{}
+	}
+	if last, ok := w.last[key]; ok && time.Since(last) < w.Interval {
+		w.suppressed[key]++
+		w.mu.Unlock()
+		return
+	}
+	if n := w.suppressed[key]; n > 0 {
+		text += fmt.Sprintf(" (%d similar alerts suppressed)", n)
+	}
+	w.last[key] = time.Now()
+	w.suppressed[key] = 0
+	w.mu.Unlock()
+
+	go func() {
+		if err := w.send(text); err != nil && w.OnError != nil {
+			w.OnError(err)
+		}
+	}()
+}
+
+func (w *Webhook) send(text string) error {
+	body, err := json.Marshal(map[string]string{"text": "[snippety] " + text})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("alert: webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+// Burst detects N events within Window, such as repeated panics.
+type Burst struct {
+	N      int
+	Window time.Duration
+
+	mu    sync.Mutex
+	times []time.Time
+}
+
+// Hit records an event and reports whether at least N happened within the
+// last Window.
+func (b *Burst) Hit() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.times = append(b.times, now)
+
+	i := 0
+	for i < len(b.times) && now.Sub(b.times[i]) > b.Window {
+		i++
+	}
+	b.times = b.times[i:]
+
+	return len(b.times) >= b.N
+}
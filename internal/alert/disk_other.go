@@ -0,0 +1,10 @@
+//go:build !unix
+
+package alert
+
+import "errors"
+
+// DiskFree is only implemented on Unix systems.
+func DiskFree(dir string) (float64, error) {
+	return 0, errors.ErrUnsupported
+}
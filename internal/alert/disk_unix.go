@@ -0,0 +1,18 @@
+//go:build unix
+
+package alert
+
+import "syscall"
+
+// DiskFree returns the fraction of space available to unprivileged users
+// on the filesystem holding dir.
+func DiskFree(dir string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	if st.Blocks == 0 {
+		return 1, nil
+	}
+	return float64(st.Bavail) / float64(st.Blocks), nil
+}
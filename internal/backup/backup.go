@@ -0,0 +1,216 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"snippety/internal/models"
+	"time"
+)
+
+// Version of the archive layout. Bump it whenever the shape of the files
+// below changes so restores can refuse archives they don't understand.
+//
+// Version 2 added publish_at, version 3 added language, version 4 added
+// metadata and version 5 added templates and banners. Older archives are
+// still read: their snippets count as published when they were created,
+// and as plain text without metadata, and they hold no templates or
+// banners.
+const Version = 5
+
+const (
+	manifestFile  = "manifest.json"
+	snippetsFile  = "snippets.json"
+	templatesFile = "templates.json"
+	bannersFile   = "banners.json"
+)
+
+type Manifest struct {
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Snippets  int       `json:"snippets"`
+	Templates int       `json:"templates"`
+	Banners   int       `json:"banners"`
+}
+
+// Contents is everything an archive holds.
+type Contents struct {
+	Snippets  []models.Snippet
+	Templates []models.SnippetTemplate
+	Banners   []models.Banner
+}
+
+// Snippet is the archived form of models.Snippet. It is kept separate so
+// the archive format doesn't change when the model does.
+type Snippet struct {
+	ID        int             `json:"id"`
+	Title     string          `json:"title"`
+	Content   string          `json:"content"`
+	Language  string          `json:"language,omitempty"`
+	Created   time.Time       `json:"created"`
+	Expires   time.Time       `json:"expires"`
+	PublishAt time.Time       `json:"publish_at"`
+	Metadata  models.Metadata `json:"metadata,omitempty"`
+}
+
+// Template is the archived form of models.SnippetTemplate.
+type Template struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Banner is the archived form of models.Banner.
+type Banner struct {
+	ID      int       `json:"id"`
+	Message string    `json:"message"`
+	Level   string    `json:"level"`
+	Starts  time.Time `json:"starts"`
+	Ends    time.Time `json:"ends"`
+}
+
+// Write a gzipped tar archive containing a manifest and the contents.
+func Write(w io.Writer, c Contents) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	snippets := make([]Snippet, len(c.Snippets))
+	for i, s := range c.Snippets {
+		snippets[i] = Snippet{ID: s.ID, Title: s.Title, Content: s.Content, Language: s.Language, Created: s.Created, Expires: s.Expires, PublishAt: s.PublishAt, Metadata: s.Metadata}
+	}
+	templates := make([]Template, len(c.Templates))
+	for i, t := range c.Templates {
+		templates[i] = Template(t)
+	}
+	banners := make([]Banner, len(c.Banners))
+	for i, b := range c.Banners {
+		banners[i] = Banner(b)
+	}
+
+	manifest := Manifest{Version: Version, Created: time.Now().UTC(), Snippets: len(snippets), Templates: len(templates), Banners: len(banners)}
+
+	if err := writeJSON(tw, manifestFile, manifest); err != nil {
+		return err
+	}
+	if err := writeJSON(tw, snippetsFile, snippets); err != nil {
+		return err
+	}
+	if err := writeJSON(tw, templatesFile, templates); err != nil {
+		return err
+	}
+	if err := writeJSON(tw, bannersFile, banners); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeJSON(tw *tar.Writer, name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(b)
+	return err
+}
+
+// Read an archive produced by Write, rejecting unknown format versions.
+func Read(r io.Reader) (Manifest, Contents, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, Contents{}, fmt.Errorf("backup: not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	var (
+		manifest  Manifest
+		snippets  []Snippet
+		templates []Template
+		banners   []Banner
+		seen      = map[string]bool{}
+	)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Manifest{}, Contents{}, err
+		}
+
+		switch hdr.Name {
+		case manifestFile:
+			err = json.NewDecoder(tr).Decode(&manifest)
+		case snippetsFile:
+			err = json.NewDecoder(tr).Decode(&snippets)
+		case templatesFile:
+			err = json.NewDecoder(tr).Decode(&templates)
+		case bannersFile:
+			err = json.NewDecoder(tr).Decode(&banners)
+		}
+		if err != nil {
+			return Manifest{}, Contents{}, fmt.Errorf("backup: reading %s: %w", hdr.Name, err)
+		}
+		seen[hdr.Name] = true
+	}
+
+	if !seen[manifestFile] {
+		return Manifest{}, Contents{}, fmt.Errorf("backup: archive has no %s", manifestFile)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return Manifest{}, Contents{}, fmt.Errorf("backup: unsupported archive version %d (expected 1 to %d)", manifest.Version, Version)
+	}
+	required := []string{snippetsFile}
+	if manifest.Version >= 5 {
+		required = append(required, templatesFile, bannersFile)
+	}
+	for _, name := range required {
+		if !seen[name] {
+			return Manifest{}, Contents{}, fmt.Errorf("backup: archive has no %s", name)
+		}
+	}
+	switch {
+	case len(snippets) != manifest.Snippets:
+		return Manifest{}, Contents{}, fmt.Errorf("backup: manifest lists %d snippets but archive has %d", manifest.Snippets, len(snippets))
+	case len(templates) != manifest.Templates:
+		return Manifest{}, Contents{}, fmt.Errorf("backup: manifest lists %d templates but archive has %d", manifest.Templates, len(templates))
+	case len(banners) != manifest.Banners:
+		return Manifest{}, Contents{}, fmt.Errorf("backup: manifest lists %d banners but archive has %d", manifest.Banners, len(banners))
+	}
+
+	var c Contents
+	c.Snippets = make([]models.Snippet, len(snippets))
+	for i, s := range snippets {
+		c.Snippets[i] = models.Snippet{ID: s.ID, Title: s.Title, Content: s.Content, Language: s.Language, Created: s.Created, Expires: s.Expires, PublishAt: s.PublishAt, Metadata: s.Metadata}
+	}
+	for _, t := range templates {
+		c.Templates = append(c.Templates, models.SnippetTemplate(t))
+	}
+	for _, b := range banners {
+		c.Banners = append(c.Banners, models.Banner(b))
+	}
+
+	return manifest, c, nil
+}
@@ -0,0 +1,93 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker opens after Threshold consecutive failures and rejects calls
+// until Cooldown has passed. It then lets a single trial call through:
+// success closes it again, failure re-opens it for another cooldown.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// Optional hook called, outside the lock, each time the breaker opens.
+	OnOpen func()
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+}
+
+// Report whether a call may proceed.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		return true
+	case HalfOpen:
+		// A trial call is already in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+// Record a successful call.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = Closed
+	b.failures = 0
+}
+
+// Record a failed call, reporting whether this failure opened the breaker.
+func (b *Breaker) Failure() bool {
+	b.mu.Lock()
+	b.failures++
+	opened := b.state == HalfOpen || (b.state == Closed && b.failures >= b.Threshold)
+	if opened {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+	b.mu.Unlock()
+
+	if opened && b.OnOpen != nil {
+		b.OnOpen()
+	}
+	return opened
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
@@ -0,0 +1,88 @@
+// Package bus is an in-process publish/subscribe bus. Code that changes
+// something publishes what happened, and features that react to it (the
+// search index, the activity log, and later webhooks or live streams)
+// subscribe, so handlers don't need to know about any of them.
+package bus
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Topic names a kind of event, in the form noun.verb.
+type Topic string
+
+const (
+	SnippetCreated Topic = "snippet.created"
+	SnippetUpdated Topic = "snippet.updated"
+	// A scheduled snippet's publish time has passed. Snippets published as
+	// they're created only get SnippetCreated.
+	SnippetPublished Topic = "snippet.published"
+)
+
+// Event is one published occurrence of a topic.
+type Event struct {
+	Topic     Topic
+	SnippetID int
+	// The snippet's title, when the publisher has it, so subscribers
+	// needn't load the snippet for it. Always set for SnippetCreated and
+	// SnippetPublished.
+	Title string
+	// When a created snippet is to be published; zero if it was published
+	// as it was created. Only set for SnippetCreated.
+	PublishAt time.Time
+	Time      time.Time
+}
+
+// Subscriber handles events. It runs on the publisher's goroutine, so
+// anything slow should be handed to a background job.
+type Subscriber func(Event)
+
+// Bus delivers events to the subscribers of their topic. The zero value
+// is ready to use.
+type Bus struct {
+	// Logs subscriber panics. Nil discards them.
+	Logger *slog.Logger
+
+	mu   sync.RWMutex
+	subs map[Topic][]Subscriber
+}
+
+// Subscribe calls fn for every event published to topic from now on.
+func (b *Bus) Subscribe(topic Topic, fn Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs == nil {
+		b.subs = map[Topic][]Subscriber{}
+	}
+	b.subs[topic] = append(b.subs[topic], fn)
+}
+
+// Publish delivers e to each subscriber of its topic in the order they
+// subscribed, setting its Time if it is zero. A subscriber that panics is
+// logged and skipped so the others still run.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	subs := b.subs[e.Topic]
+	b.mu.RUnlock()
+
+	for _, fn := range subs {
+		b.deliver(fn, e)
+	}
+}
+
+func (b *Bus) deliver(fn Subscriber, e Event) {
+	defer func() {
+		if v := recover(); v != nil && b.Logger != nil {
+			b.Logger.Error("event subscriber panicked", slog.String("topic", string(e.Topic)), slog.String("panic", fmt.Sprint(v)))
+		}
+	}()
+	fn(e)
+}
@@ -0,0 +1,125 @@
+// Package diff compares two texts line by line.
+package diff
+
+import "strings"
+
+// Op says what happened to a line going from the old text to the new one.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+func (op Op) String() string {
+	switch op {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Line is one line of a diff, without its newline.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Above this many cells in the LCS table, the changed middle of the texts
+// is reported as deleted then inserted rather than compared line by line.
+// 1<<20 int32s is 4MB per comparison.
+const maxCells = 1 << 20
+
+// Lines returns a shortest line diff turning a into b, with deletions
+// listed before insertions in each changed run.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+
+	// Most comparisons are of two versions of the same text, so trimming
+	// the common ends usually leaves little to compare.
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	out := make([]Line, 0, max(len(x), len(y)))
+	out = appendLines(out, Equal, x[:pre])
+	out = appendMiddle(out, x[pre:len(x)-suf], y[pre:len(y)-suf])
+	out = appendLines(out, Equal, x[len(x)-suf:])
+	return out
+}
+
+// Count returns the number of inserted and deleted lines.
+func Count(lines []Line) (inserted, deleted int) {
+	for _, l := range lines {
+		switch l.Op {
+		case Insert:
+			inserted++
+		case Delete:
+			deleted++
+		}
+	}
+	return inserted, deleted
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func appendLines(out []Line, op Op, lines []string) []Line {
+	for _, text := range lines {
+		out = append(out, Line{Op: op, Text: text})
+	}
+	return out
+}
+
+// Diff x and y using a table of longest common subsequence lengths, where
+// lcs[i*(m+1)+j] is the LCS length of x[i:] and y[j:].
+func appendMiddle(out []Line, x, y []string) []Line {
+	n, m := len(x), len(y)
+	if n == 0 || m == 0 || n*m > maxCells {
+		out = appendLines(out, Delete, x)
+		return appendLines(out, Insert, y)
+	}
+
+	w := m + 1
+	lcs := make([]int32, (n+1)*w)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else {
+				lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, Line{Op: Equal, Text: x[i]})
+			i++
+			j++
+		case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+			out = append(out, Line{Op: Delete, Text: x[i]})
+			i++
+		default:
+			out = append(out, Line{Op: Insert, Text: y[j]})
+			j++
+		}
+	}
+	out = appendLines(out, Delete, x[i:])
+	return appendLines(out, Insert, y[j:])
+}
@@ -0,0 +1,122 @@
+// Package errreport sends unexpected server errors, with their stack and
+// request, to an external service: Sentry or a generic JSON webhook.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Event is one error to report.
+type Event struct {
+	Time    time.Time
+	Message string
+	// Go type of the error, such as "*fmt.wrapError".
+	Type    string
+	Stack   []Frame
+	Request Request
+}
+
+// Frame is one call in a stack, innermost first.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Request describes the request that caused the error. Headers must not
+// include credentials or cookies; see Redact.
+type Request struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	ClientIP string      `json:"client_ip"`
+	Headers  http.Header `json:"headers,omitempty"`
+}
+
+// Reporter sends an event somewhere.
+type Reporter interface {
+	Report(ctx context.Context, e Event) error
+}
+
+// NewEvent builds an event for err, with the stack of the caller skip
+// levels up (0 is the caller of NewEvent).
+func NewEvent(err error, skip int) Event {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	e := Event{Time: time.Now().UTC(), Message: err.Error(), Type: fmt.Sprintf("%T", err)}
+	for {
+		f, more := frames.Next()
+		e.Stack = append(e.Stack, Frame{Function: f.Function, File: f.File, Line: f.Line})
+		if !more {
+			break
+		}
+	}
+	return e
+}
+
+// Headers never sent with a report.
+var redacted = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// Redact returns a copy of h without credentials or cookies.
+func Redact(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redacted {
+		h.Del(name)
+	}
+	return h
+}
+
+// Webhook posts each event as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Report(ctx context.Context, e Event) error {
+	body, err := json.Marshal(map[string]any{
+		"time":    e.Time,
+		"message": e.Message,
+		"type":    e.Type,
+		"stack":   e.Stack,
+		"request": e.Request,
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Client, w.URL, body, nil)
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("errreport: %s returned %s: %s", url, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package errreport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Sentry sends events to a Sentry project through its store endpoint.
+type Sentry struct {
+	Client *http.Client
+	// Reported with each event so errors can be matched to a build.
+	Release    string
+	ServerName string
+
+	storeURL string
+	key      string
+}
+
+// NewSentry parses a project DSN of the form
+// https://<key>@<host>/<project id>.
+func NewSentry(dsn string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("errreport: invalid Sentry DSN: %w", err)
+	}
+	project := path.Base(u.Path)
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || project == "/" || project == "." {
+		return nil, errors.New("errreport: invalid Sentry DSN: want https://<key>@<host>/<project id>")
+	}
+
+	store := url.URL{Scheme: u.Scheme, Host: u.Host, Path: path.Join(path.Dir(u.Path), "api", project, "store") + "/"}
+	return &Sentry{storeURL: store.String(), key: u.User.Username()}, nil
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+func (s *Sentry) Report(ctx context.Context, e Event) error {
+	// Sentry lists frames outermost first.
+	frames := make([]sentryFrame, len(e.Stack))
+	for i, f := range e.Stack {
+		frames[len(frames)-1-i] = sentryFrame{
+			Function: f.Function,
+			Filename: f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Function, "main.") || strings.HasPrefix(f.Function, "snippety/"),
+		}
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	headers := map[string]string{}
+	for name := range e.Request.Headers {
+		headers[name] = e.Request.Headers.Get(name)
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   e.Time,
+		"level":       "error",
+		"platform":    "go",
+		"logger":      "snippety",
+		"release":     s.Release,
+		"server_name": s.ServerName,
+		"exception": map[string]any{
+			"values": []any{map[string]any{
+				"type":       e.Type,
+				"value":      e.Message,
+				"stacktrace": map[string]any{"frames": frames},
+			}},
+		},
+		"request": map[string]any{
+			"method":  e.Request.Method,
+			"url":     e.Request.URL,
+			"headers": headers,
+			"env":     map[string]string{"REMOTE_ADDR": e.Request.ClientIP},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	auth := http.Header{}
+	auth.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=snippety/1.0, sentry_key="+s.key)
+	return post(ctx, s.Client, s.storeURL, body, auth)
+}
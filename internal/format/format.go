@@ -0,0 +1,153 @@
+// Package format pretty-prints snippet content in languages that have a
+// canonical layout.
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnsupported is returned by Format for languages with no formatter.
+var ErrUnsupported = errors.New("format: no formatter for language")
+
+// A Formatter rewrites source into its canonical layout. It returns an
+// error if the source cannot be parsed.
+type Formatter func(src string) (string, error)
+
+// Formatters keyed by the language names stored on snippets.
+var formatters = map[string]Formatter{
+	"go":   goFormat,
+	"json": jsonFormat,
+	"xml":  xmlFormat,
+	"yaml": yamlFormat,
+}
+
+// Languages returns the names of every language with a formatter, sorted.
+func Languages() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Supported reports whether language has a formatter.
+func Supported(language string) bool {
+	_, ok := formatters[language]
+	return ok
+}
+
+// Format src as language.
+func Format(language, src string) (string, error) {
+	f, ok := formatters[language]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnsupported, language)
+	}
+	return f(src)
+}
+
+func goFormat(src string) (string, error) {
+	b, err := format.Source([]byte(src))
+	return string(b), err
+}
+
+func jsonFormat(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(src), "", "  "); err != nil {
+		return "", err
+	}
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// Re-encode the token stream with indentation. Comments, processing
+// instructions and directives are kept; whitespace-only text between
+// elements is dropped so it can be replaced by the indentation.
+func xmlFormat(src string) (string, error) {
+	var buf bytes.Buffer
+	dec := xml.NewDecoder(strings.NewReader(src))
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		case xml.StartElement:
+			t.Name = flatName(t.Name)
+			t.Attr = slices.Clone(t.Attr)
+			for i := range t.Attr {
+				t.Attr[i].Name = flatName(t.Attr[i].Name)
+			}
+			tok = t
+		case xml.EndElement:
+			t.Name = flatName(t.Name)
+			tok = t
+		}
+		if err := enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return "", err
+	}
+
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// RawToken leaves namespace prefixes unresolved in Name.Space, which the
+// encoder would treat as a namespace URL. Writing "prefix:local" as the
+// local name reproduces the input as written.
+func flatName(n xml.Name) xml.Name {
+	if n.Space == "" {
+		return n
+	}
+	return xml.Name{Local: n.Space + ":" + n.Local}
+}
+
+// Round-trip through yaml.Node, which keeps comments and key order.
+func yamlFormat(src string) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	dec := yaml.NewDecoder(strings.NewReader(src))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,151 @@
+// Package hooks lets a fork extend snippety without patching its handlers.
+// Register extensions from an init function in a file added to cmd/web,
+// or in a package cmd/web imports for its side effects:
+//
+//	func init() {
+//		hooks.BeforeSave(func(d *hooks.Draft) error {
+//			if strings.Contains(d.Content, "BEGIN RSA PRIVATE KEY") {
+//				return &hooks.Rejection{Field: "content", Message: "must not contain a private key"}
+//			}
+//			return nil
+//		})
+//		hooks.AfterCreate(func(s models.Snippet) { notifyChat(s.Title) })
+//		hooks.TemplateFunc("shout", strings.ToUpper)
+//		hooks.Route("GET /about", http.HandlerFunc(about))
+//	}
+//
+// Everything must be registered before the server starts; registering
+// later has no effect.
+package hooks
+
+import (
+	"html/template"
+	"net/http"
+	"snippety/internal/models"
+	"sync"
+)
+
+// Draft is a snippet about to be saved by the create page, the API or
+// quick save. Filters may change its fields.
+type Draft struct {
+	Title    string
+	Content  string
+	Language string
+}
+
+// Filter checks or rewrites a draft before it is validated and saved.
+// Returning a *Rejection refuses the save with a message for the user;
+// any other error fails the request as a server error.
+type Filter func(d *Draft) error
+
+// Rejection is returned by a Filter to refuse a save.
+type Rejection struct {
+	// The field the message is shown against: title, content or language.
+	Field   string
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return r.Field + " " + r.Message
+}
+
+// A route added to the server's mux. Admin routes require the admin
+// password like the built-in admin pages.
+type RouteSpec struct {
+	Pattern string
+	Handler http.Handler
+	Admin   bool
+}
+
+var (
+	mu          sync.RWMutex
+	filters     []Filter
+	afterCreate []func(models.Snippet)
+	funcs       = template.FuncMap{}
+	routes      []RouteSpec
+)
+
+// BeforeSave adds a filter run, in order of registration, on every
+// snippet created or edited. Filters see content after newline clean-up.
+func BeforeSave(f Filter) {
+	mu.Lock()
+	defer mu.Unlock()
+	filters = append(filters, f)
+}
+
+// AfterCreate adds a function called with each new snippet once it has
+// been saved. It runs from a background job shortly after the request,
+// and may be run again if the server stops part way; a panic is logged
+// and doesn't stop the other hooks.
+func AfterCreate(fn func(models.Snippet)) {
+	mu.Lock()
+	defer mu.Unlock()
+	afterCreate = append(afterCreate, fn)
+}
+
+// TemplateFunc makes fn available to every template as name, replacing a
+// built-in function of the same name.
+func TemplateFunc(name string, fn any) {
+	mu.Lock()
+	defer mu.Unlock()
+	funcs[name] = fn
+}
+
+// Route adds h to the server under pattern, in http.ServeMux syntax. A
+// pattern that conflicts with a built-in route panics at startup.
+func Route(pattern string, h http.Handler) {
+	addRoute(RouteSpec{Pattern: pattern, Handler: h})
+}
+
+// AdminRoute is like Route, but only the admin may use the route.
+func AdminRoute(pattern string, h http.Handler) {
+	addRoute(RouteSpec{Pattern: pattern, Handler: h, Admin: true})
+}
+
+func addRoute(r RouteSpec) {
+	mu.Lock()
+	defer mu.Unlock()
+	routes = append(routes, r)
+}
+
+// Filtering reports whether any filters are registered, so callers can
+// skip work that only filters need.
+func Filtering() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(filters) > 0
+}
+
+// RunFilters runs the registered filters on d, stopping at the first error.
+func RunFilters(d *Draft) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, f := range filters {
+		if err := f(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterCreateHooks returns the functions registered with AfterCreate.
+func AfterCreateHooks() []func(models.Snippet) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return afterCreate
+}
+
+// TemplateFuncs returns the functions registered with TemplateFunc.
+func TemplateFuncs() template.FuncMap {
+	mu.RLock()
+	defer mu.RUnlock()
+	return funcs
+}
+
+// Routes returns the routes registered with Route and AdminRoute.
+func Routes() []RouteSpec {
+	mu.RLock()
+	defer mu.RUnlock()
+	return routes
+}
@@ -0,0 +1,281 @@
+// Package jobs runs background work from a queue kept in storage, so it
+// survives restarts with the MySQL backend and can be shared by several
+// servers. Handlers are registered per kind of job; failed jobs are
+// retried with exponential backoff and given up on after MaxAttempts,
+// when they are kept as dead for inspection. Recurring jobs run every so
+// often on whichever server claims them, and are retried but never given
+// up on.
+//
+//	pool := &jobs.Pool{Store: store.Jobs(), Logger: logger}
+//	pool.Handle("index_snippet", indexSnippet)
+//	go pool.Run(ctx)
+//	pool.Enqueue("index_snippet", id)
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"snippety/internal/models"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handler does one job. payload is the JSON the job was enqueued with.
+// Returning an error retries the job later, so handlers must be safe to
+// run more than once. ctx is cancelled shortly before the job's lease
+// runs out, or when the pool is stopped; a handler that carries on past
+// that may find another worker running the job too.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Defaults for the zero values of Pool's fields.
+const (
+	DefaultWorkers     = 4
+	DefaultMaxAttempts = 5
+	DefaultLease       = 5 * time.Minute
+	DefaultPoll        = time.Second
+	// First retry delay, doubled on each further attempt up to maxBackoff.
+	DefaultBackoff = 10 * time.Second
+	maxBackoff     = 6 * time.Hour
+	// Time left between a handler's context ending and its lease running
+	// out, to record the result in. At most a tenth of the lease.
+	leaseMargin = 10 * time.Second
+)
+
+// Pool claims due jobs from Store and runs them on Workers goroutines.
+type Pool struct {
+	Store  models.JobModelInterface
+	Logger *slog.Logger
+
+	Workers     int
+	MaxAttempts int
+	// How long a worker holds a job before another may take it over,
+	// which must be longer than any job takes. Handlers' contexts end
+	// leaseMargin before it does.
+	Lease time.Duration
+	// How often idle workers look for due jobs.
+	Poll    time.Duration
+	Backoff time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	// How often each recurring kind runs.
+	every map[string]time.Duration
+
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	died      atomic.Int64
+}
+
+// Stats counts the jobs this process has run since it started.
+type Stats struct {
+	Succeeded int64
+	// Failed attempts, including those that made a job dead.
+	Failed int64
+	Died   int64
+}
+
+// Handle registers h for jobs of the given kind. Call it before Run.
+func (p *Pool) Handle(kind string, h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.handlers == nil {
+		p.handlers = map[string]Handler{}
+	}
+	p.handlers[kind] = h
+}
+
+// HandleEvery registers h for a recurring job of the given kind, which
+// runs about every interval however many servers share the queue. Call it
+// before Run, which queues the job if it isn't already.
+func (p *Pool) HandleEvery(kind string, interval time.Duration, h Handler) {
+	p.Handle(kind, h)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.every == nil {
+		p.every = map[string]time.Duration{}
+	}
+	p.every[kind] = interval
+}
+
+// Enqueue adds a job to run as soon as a worker is free. payload is
+// encoded as JSON.
+func (p *Pool) Enqueue(kind string, payload any) error {
+	return p.EnqueueAt(kind, payload, time.Time{})
+}
+
+// EnqueueAt adds a job that won't run before runAt. The zero time means
+// now, by the database's clock.
+func (p *Pool) EnqueueAt(kind string, payload any, runAt time.Time) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("jobs: encoding %s payload: %w", kind, err)
+	}
+	_, err = p.Store.Enqueue(kind, b, runAt)
+	return err
+}
+
+func (p *Pool) Stats() Stats {
+	return Stats{Succeeded: p.succeeded.Load(), Failed: p.failed.Load(), Died: p.died.Load()}
+}
+
+// Run works through jobs until ctx is cancelled, then waits for jobs in
+// progress to finish. Their handlers' contexts are cancelled too, and
+// jobs that stop early are left to run again straight away.
+func (p *Pool) Run(ctx context.Context) {
+	go p.enqueueRecurring(ctx)
+
+	var wg sync.WaitGroup
+	for range cmp.Or(p.Workers, DefaultWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Queue the recurring jobs, trying again every Poll until the store
+// takes them all.
+func (p *Pool) enqueueRecurring(ctx context.Context) {
+	p.mu.RLock()
+	var kinds []string
+	for kind := range p.every {
+		kinds = append(kinds, kind)
+	}
+	p.mu.RUnlock()
+
+	poll := time.NewTicker(cmp.Or(p.Poll, DefaultPoll))
+	defer poll.Stop()
+
+	for len(kinds) > 0 {
+		var failed []string
+		for _, kind := range kinds {
+			if err := p.Store.EnqueueRecurring(kind); err != nil {
+				if !errors.Is(err, models.ErrUnavailable) {
+					p.Logger.Error("queueing recurring job failed", slog.String("kind", kind), slog.String("error", err.Error()))
+				}
+				failed = append(failed, kind)
+			}
+		}
+		kinds = failed
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+func (p *Pool) work(ctx context.Context) {
+	poll := time.NewTicker(cmp.Or(p.Poll, DefaultPoll))
+	defer poll.Stop()
+
+	for {
+		// Run jobs back to back while there are any, then wait.
+		for ctx.Err() == nil && p.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// Claim and run one job, reporting whether there was one.
+func (p *Pool) runNext(ctx context.Context) bool {
+	lease := cmp.Or(p.Lease, DefaultLease)
+	job, err := p.Store.Claim(lease)
+	if err != nil {
+		// While the breaker is open the database is known to be down, and
+		// every poll would log it.
+		if !errors.Is(err, models.ErrNoRecord) && !errors.Is(err, models.ErrUnavailable) {
+			p.Logger.Error("claiming job failed", slog.String("error", err.Error()))
+		}
+		return false
+	}
+
+	p.mu.RLock()
+	h, ok := p.handlers[job.Kind]
+	interval, recurring := p.every[job.Kind]
+	p.mu.RUnlock()
+
+	if ok {
+		hctx, cancel := context.WithTimeout(ctx, lease-min(leaseMargin, lease/10))
+		err = runHandler(hctx, h, job.Payload)
+		cancel()
+	} else {
+		err = fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	if err == nil {
+		p.succeeded.Add(1)
+		if recurring {
+			err = p.Store.Reschedule(job.ID, interval)
+		} else {
+			err = p.Store.Complete(job.ID)
+		}
+		if err != nil {
+			p.Logger.Error("completing job failed", slog.Int("id", job.ID), slog.String("error", err.Error()))
+		}
+		return true
+	}
+
+	// Stopped by shutdown rather than failed: hand it straight back.
+	if ctx.Err() != nil {
+		p.Logger.Info("job interrupted by shutdown", slog.Int("id", job.ID), slog.String("kind", job.Kind))
+		if err := p.Store.Fail(job.ID, err.Error(), 0, false); err != nil {
+			p.Logger.Error("releasing job failed", slog.Int("id", job.ID), slog.String("error", err.Error()))
+		}
+		return true
+	}
+
+	p.failed.Add(1)
+	dead := !recurring && job.Attempts >= cmp.Or(p.MaxAttempts, DefaultMaxAttempts)
+	var delay time.Duration
+	if dead {
+		p.died.Add(1)
+		p.Logger.Error("job failed for the last time", slog.Int("id", job.ID), slog.String("kind", job.Kind), slog.Int("attempts", job.Attempts), slog.String("error", err.Error()))
+	} else {
+		delay = p.backoff(job.Attempts)
+		if recurring {
+			delay = min(delay, interval)
+		}
+		p.Logger.Warn("job failed, will retry", slog.Int("id", job.ID), slog.String("kind", job.Kind), slog.Int("attempts", job.Attempts), slog.Duration("retry_in", delay), slog.String("error", err.Error()))
+	}
+
+	if err := p.Store.Fail(job.ID, err.Error(), delay, dead); err != nil {
+		p.Logger.Error("recording job failure failed", slog.Int("id", job.ID), slog.String("error", err.Error()))
+	}
+	return true
+}
+
+// Run h, turning a panic into an error so one bad job can't take the
+// worker down.
+func runHandler(ctx context.Context, h Handler, payload []byte) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return h(ctx, payload)
+}
+
+func (p *Pool) backoff(attempts int) time.Duration {
+	d := cmp.Or(p.Backoff, DefaultBackoff)
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
@@ -0,0 +1,190 @@
+// Package logfile writes logs to a file that is rotated when it grows too
+// large or too old. Rotated files are renamed with a timestamp, optionally
+// gzipped, and deleted once there are more than a set number of them.
+package logfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timestamp added to rotated files, as in app-2026-10-16T08-21-06.000.log.
+// It sorts in time order and has no characters awkward in file names.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Options control when a File rotates and what happens to old files. Zero
+// values disable the corresponding limit.
+type Options struct {
+	// Rotate before a write would take the file past this size.
+	MaxBytes int64
+	// Rotate once the current file has been open this long.
+	MaxAge time.Duration
+	// Gzip rotated files.
+	Compress bool
+	// Number of rotated files to keep. Older ones are deleted.
+	Keep int
+}
+
+// File is an io.Writer safe for concurrent use.
+type File struct {
+	path string
+	opts Options
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// Serialises compressing and pruning, which run in the background.
+	mill sync.Mutex
+}
+
+// Open path for appending, creating it if needed.
+func Open(path string, opts Options) (*File, error) {
+	l := &File{path: path, opts: opts}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *File) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.f = f
+	l.size = info.Size()
+	l.opened = time.Now()
+	return nil
+}
+
+func (l *File) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tooBig := l.opts.MaxBytes > 0 && l.size > 0 && l.size+int64(len(p)) > l.opts.MaxBytes
+	tooOld := l.opts.MaxAge > 0 && time.Since(l.opened) >= l.opts.MaxAge
+	if tooBig || tooOld {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it with a timestamp and opens a
+// new one in its place.
+func (l *File) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rotate()
+}
+
+func (l *File) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(l.path)
+	backup := strings.TrimSuffix(l.path, ext) + "-" + time.Now().UTC().Format(backupTimeFormat) + ext
+	if err := os.Rename(l.path, backup); err != nil {
+		return err
+	}
+
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	go l.cleanUp(backup)
+	return nil
+}
+
+// Compress the newly rotated file if asked to, then delete the oldest
+// backups beyond Keep. Errors are ignored: the log can't report problems
+// with itself, and the next rotation tries again.
+func (l *File) cleanUp(backup string) {
+	l.mill.Lock()
+	defer l.mill.Unlock()
+
+	if l.opts.Compress {
+		if err := compress(backup); err == nil {
+			os.Remove(backup)
+		}
+	}
+
+	if l.opts.Keep <= 0 {
+		return
+	}
+
+	backups := l.backups()
+	if len(backups) <= l.opts.Keep {
+		return
+	}
+	for _, name := range backups[:len(backups)-l.opts.Keep] {
+		os.Remove(name)
+	}
+}
+
+// Return the rotated files for this log, oldest first.
+func (l *File) backups() []string {
+	ext := filepath.Ext(l.path)
+	prefix := strings.TrimSuffix(l.path, ext) + "-"
+
+	matches, _ := filepath.Glob(prefix + "*")
+	var backups []string
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, name)
+		}
+	}
+	slices.Sort(backups)
+	return backups
+}
+
+func compress(name string) (err error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(name + ".gz")
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	return errors.Join(err, zw.Close(), out.Close())
+}
+
+// Close the current file.
+func (l *File) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
@@ -0,0 +1,193 @@
+// Package minify makes conservative size reductions to HTML documents.
+// Comments are removed and whitespace runs collapsed, the contents of
+// <pre> and <textarea> are left exactly as they are, and inline scripts
+// only lose indentation and blank lines.
+package minify
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Elements whose content is copied verbatim or handled separately.
+var rawElements = []string{"pre", "textarea", "script", "style"}
+
+// HTML returns a minified copy of an HTML document.
+func HTML(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+
+	for i := 0; i < len(src); {
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			comment := src[i : i+4+end+3]
+			// Conditional comments are instructions to old browsers.
+			if bytes.HasPrefix(comment, []byte("<!--[if")) {
+				out = append(out, comment...)
+			}
+			i += len(comment)
+
+		case src[i] == '<':
+			end := tagEnd(src, i)
+			tag := src[i:end]
+			out = appendTag(out, tag)
+			i = end
+
+			name := rawElement(tag)
+			if name == "" {
+				continue
+			}
+
+			closeAt := indexFold(src[i:], []byte("</"+name))
+			if closeAt < 0 {
+				closeAt = len(src) - i
+			}
+			body := src[i : i+closeAt]
+			switch name {
+			case "style":
+				body = CSS(body)
+			case "script":
+				body = JS(body)
+			}
+			out = append(out, body...)
+			i += closeAt
+
+		default:
+			end := bytes.IndexByte(src[i:], '<')
+			if end < 0 {
+				end = len(src) - i
+			}
+			out = appendText(out, src[i:i+end])
+			i += end
+		}
+	}
+
+	return out
+}
+
+// Return the index just past the '>' closing the tag starting at i,
+// skipping over quoted attribute values.
+func tagEnd(src []byte, i int) int {
+	var quote byte
+	for j := i + 1; j < len(src); j++ {
+		switch c := src[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// Append a tag with whitespace runs outside attribute values collapsed to
+// a single space, and none left before the closing '>'.
+func appendTag(out, tag []byte) []byte {
+	var quote byte
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case isSpace(c):
+			for i+1 < len(tag) && isSpace(tag[i+1]) {
+				i++
+			}
+			if i+1 < len(tag) && tag[i+1] == '>' {
+				continue
+			}
+			c = ' '
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Return the name of the raw element opened by tag, or "".
+func rawElement(tag []byte) string {
+	for _, name := range rawElements {
+		if len(tag) > len(name)+1 && bytes.EqualFold(tag[1:len(name)+1], []byte(name)) {
+			switch tag[len(name)+1] {
+			case '>', ' ', '\t', '\n', '\r', '/':
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func indexFold(s, sep []byte) int {
+	return bytes.Index(bytes.ToLower(s), bytes.ToLower(sep))
+}
+
+// Append text with each whitespace run collapsed to a single space, or a
+// newline if the run contained one, so line-based tools still work.
+func appendText(out, text []byte) []byte {
+	for i := 0; i < len(text); i++ {
+		if !isSpace(text[i]) {
+			out = append(out, text[i])
+			continue
+		}
+
+		newline := false
+		for ; i < len(text) && isSpace(text[i]); i++ {
+			newline = newline || text[i] == '\n'
+		}
+		i--
+
+		if newline {
+			out = append(out, '\n')
+		} else {
+			out = append(out, ' ')
+		}
+	}
+	return out
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+var (
+	cssComment    = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssSpace      = regexp.MustCompile(`\s+`)
+	cssPunctSpace = regexp.MustCompile(`\s*([{};])\s*`)
+)
+
+// CSS removes comments and collapses whitespace in a stylesheet.
+// Whitespace is only dropped around braces and semicolons; around other
+// characters, such as the ':' in "a :hover", it can be significant.
+func CSS(src []byte) []byte {
+	src = cssComment.ReplaceAll(src, nil)
+	src = cssSpace.ReplaceAll(src, []byte(" "))
+	src = cssPunctSpace.ReplaceAll(src, []byte("$1"))
+	return bytes.TrimSpace(src)
+}
+
+// JS trims indentation and blank lines from a script. Anything more needs
+// a real parser, since comments and whitespace can sit inside strings.
+func JS(src []byte) []byte {
+	var out []byte
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, line...)
+	}
+	return out
+}
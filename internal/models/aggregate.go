@@ -0,0 +1,175 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// SnippetStats summarises published snippets for the public stats page.
+type SnippetStats struct {
+	// Published snippets that haven't expired.
+	Total int
+	// Snippets created on each of the last days, oldest first. Ones that
+	// have since expired still count; ones not published yet don't.
+	PerDay []DayCount
+	// The most used languages among live snippets, most used first. Plain
+	// text is counted under "".
+	Languages []LanguageCount
+}
+
+type DayCount struct {
+	Day   time.Time
+	Count int
+}
+
+type LanguageCount struct {
+	Language string
+	Count    int
+}
+
+// The UTC days from days-1 days ago to today, each with a zero count.
+func lastDays(days int) []DayCount {
+	start := today().AddDate(0, 0, 1-days)
+	out := make([]DayCount, days)
+	for i := range out {
+		out[i].Day = start.AddDate(0, 0, i)
+	}
+	return out
+}
+
+// Add n to the entry for day, if it's in range.
+func addDay(perDay []DayCount, day time.Time, n int) {
+	if len(perDay) == 0 {
+		return
+	}
+	i := int(day.UTC().Truncate(24*time.Hour).Sub(perDay[0].Day) / (24 * time.Hour))
+	if i >= 0 && i < len(perDay) {
+		perDay[i].Count += n
+	}
+}
+
+// Stats counts live snippets, creations per day over the last days days
+// and the top languages.
+func (m *SnippetModel) Stats(days, topLanguages int) (SnippetStats, error) {
+	defer m.timed("stats")()
+
+	stats := SnippetStats{PerDay: lastDays(days)}
+
+	err := m.queryRow(`SELECT COUNT(*) FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND publish_at <= UTC_TIMESTAMP()`, nil, &stats.Total)
+	if err != nil {
+		return SnippetStats{}, err
+	}
+
+	if days > 0 {
+		rows, err := m.query(`SELECT DATE(created), COUNT(*) FROM snippets
+    WHERE created >= ? AND publish_at <= UTC_TIMESTAMP() GROUP BY DATE(created)`, stats.PerDay[0].Day)
+		if err != nil {
+			return SnippetStats{}, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				day time.Time
+				n   int
+			)
+			if err := rows.Scan(&day, &n); err != nil {
+				return SnippetStats{}, err
+			}
+			addDay(stats.PerDay, day, n)
+		}
+		if err := rows.Err(); err != nil {
+			return SnippetStats{}, err
+		}
+	}
+
+	rows, err := m.query(`SELECT language, COUNT(*) FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND publish_at <= UTC_TIMESTAMP()
+    GROUP BY language ORDER BY COUNT(*) DESC, language LIMIT ?`, topLanguages)
+	if err != nil {
+		return SnippetStats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l LanguageCount
+		if err := rows.Scan(&l.Language, &l.Count); err != nil {
+			return SnippetStats{}, err
+		}
+		stats.Languages = append(stats.Languages, l)
+	}
+	if err := rows.Err(); err != nil {
+		return SnippetStats{}, err
+	}
+
+	return stats, nil
+}
+
+// CreatedPerDay counts every snippet created on each of the last days
+// days, including ones since expired or not yet published.
+func (m *SnippetModel) CreatedPerDay(days int) ([]DayCount, error) {
+	defer m.timed("created_per_day")()
+
+	perDay := lastDays(days)
+	if days <= 0 {
+		return perDay, nil
+	}
+
+	rows, err := m.query(`SELECT DATE(created), COUNT(*) FROM snippets
+    WHERE created >= ? GROUP BY DATE(created)`, perDay[0].Day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			day time.Time
+			n   int
+		)
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		addDay(perDay, day, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return perDay, nil
+}
+
+func (m *MemorySnippetModel) Stats(days, topLanguages int) (SnippetStats, error) {
+	stats := SnippetStats{PerDay: lastDays(days)}
+	languages := map[string]int{}
+
+	for _, s := range m.filter(Snippet.Published) {
+		addDay(stats.PerDay, s.Created, 1)
+		if live(s) {
+			stats.Total++
+			languages[s.Language]++
+		}
+	}
+
+	for language, n := range languages {
+		stats.Languages = append(stats.Languages, LanguageCount{language, n})
+	}
+	slices.SortFunc(stats.Languages, func(a, b LanguageCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Language, b.Language))
+	})
+	if len(stats.Languages) > topLanguages {
+		stats.Languages = stats.Languages[:topLanguages]
+	}
+
+	return stats, nil
+}
+
+func (m *MemorySnippetModel) CreatedPerDay(days int) ([]DayCount, error) {
+	perDay := lastDays(days)
+	for _, s := range m.filter(func(Snippet) bool { return true }) {
+		addDay(perDay, s.Created, 1)
+	}
+	return perDay, nil
+}
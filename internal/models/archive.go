@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Expired snippets are kept, hidden from everyone or archived for the
+// owner to see, until they're purged.
+
+// GetArchived is Get for snippets that may have expired: it returns them
+// in full rather than as a stub with ErrExpired.
+func (m *SnippetModel) GetArchived(id int) (Snippet, error) {
+	defer m.timed("get_archived")()
+
+	stmt := `SELECT id, title, content, language, created, expires, publish_at, version, updated, metadata FROM snippets
+    WHERE id = ?`
+
+	var s Snippet
+	err := m.queryRow(stmt, []any{id}, &s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+	s.fillDerived()
+
+	return s, nil
+}
+
+// PurgeExpired deletes snippets that expired before the given time and
+// returns their ids. A tombstone is kept for each, so Changes can still
+// report it to clients that last synced before it expired.
+func (m *SnippetModel) PurgeExpired(before time.Time) ([]int, error) {
+	defer m.timed("purge_expired")()
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM snippets WHERE expires < ? FOR UPDATE`, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// The rows read above are locked, so these copy and delete the same
+	// ones. Snippets never published need no tombstone; see Changes.
+	_, err = tx.Exec(`INSERT INTO snippet_tombstones (snippet_id, expires) SELECT id, expires FROM snippets WHERE expires < ? AND publish_at <= expires
+    ON DUPLICATE KEY UPDATE expires = VALUES(expires)`, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM snippets WHERE expires < ?`, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
+
+func (m *MemorySnippetModel) GetArchived(id int) (Snippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.snippets[id]
+	if !ok {
+		return Snippet{}, ErrNoRecord
+	}
+	return s, nil
+}
+
+func (m *MemorySnippetModel) PurgeExpired(before time.Time) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for id, s := range m.snippets {
+		if s.Expires.Before(before) {
+			delete(m.snippets, id)
+			if !s.PublishAt.After(s.Expires) {
+				m.tombstones[id] = s.Expires
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *FileSnippetModel) PurgeExpired(before time.Time) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.MemorySnippetModel.PurgeExpired(before)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if err := m.saveTombstones(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		err := os.Remove(filepath.Join(m.dir, "snippets", strconv.Itoa(id)+".json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"snippety/internal/breaker"
+	"sync"
+	"time"
+)
+
+type Banner struct {
+	ID      int
+	Message string
+	// "info" or "warning"
+	Level  string
+	Starts time.Time
+	Ends   time.Time
+}
+
+// Report whether the banner should be shown at t.
+func (b Banner) ActiveAt(t time.Time) bool {
+	return !t.Before(b.Starts) && t.Before(b.Ends)
+}
+
+type BannerModelInterface interface {
+	Insert(message, level string, starts, ends time.Time) (int, error)
+	Delete(id int) error
+	Active() ([]Banner, error)
+	All() ([]Banner, error)
+}
+
+type BannerModel struct {
+	DB *sql.DB
+	// Shared with the snippet model; see guard.
+	Breaker *breaker.Breaker
+	Logger  *slog.Logger
+}
+
+// Insert a new banner.
+func (m *BannerModel) Insert(message, level string, starts, ends time.Time) (int, error) {
+	stmt := `INSERT INTO banners (message, level, starts, ends) VALUES (?, ?, ?, ?)`
+
+	var result sql.Result
+	err := guard(m.Breaker, m.Logger, func() (err error) {
+		result, err = m.DB.Exec(stmt, message, level, starts.UTC(), ends.UTC())
+		return err
+	})
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Delete a banner. Deleting a missing banner returns ErrNoRecord.
+func (m *BannerModel) Delete(id int) error {
+	var result sql.Result
+	err := guard(m.Breaker, m.Logger, func() (err error) {
+		result, err = m.DB.Exec(`DELETE FROM banners WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Return the banners that should currently be shown, oldest first.
+func (m *BannerModel) Active() ([]Banner, error) {
+	return m.list(`SELECT id, message, level, starts, ends FROM banners
+    WHERE starts <= UTC_TIMESTAMP() AND ends > UTC_TIMESTAMP() ORDER BY id`)
+}
+
+// Return every banner that hasn't ended yet, including scheduled ones.
+func (m *BannerModel) All() ([]Banner, error) {
+	return m.list(`SELECT id, message, level, starts, ends FROM banners
+    WHERE ends > UTC_TIMESTAMP() ORDER BY starts, id`)
+}
+
+func (m *BannerModel) list(stmt string) ([]Banner, error) {
+	var banners []Banner
+
+	err := guard(m.Breaker, m.Logger, func() error {
+		rows, err := m.DB.Query(stmt)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var b Banner
+			err = rows.Scan(&b.ID, &b.Message, &b.Level, &b.Starts, &b.Ends)
+			if err != nil {
+				return err
+			}
+			banners = append(banners, b)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return banners, nil
+}
+
+// MemoryBannerModel keeps banners in process memory.
+type MemoryBannerModel struct {
+	mu      sync.RWMutex
+	banners map[int]Banner
+	nextID  int
+}
+
+func NewMemoryBannerModel() *MemoryBannerModel {
+	return &MemoryBannerModel{banners: map[int]Banner{}, nextID: 1}
+}
+
+func (m *MemoryBannerModel) Insert(message, level string, starts, ends time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID
+	m.nextID++
+	m.banners[id] = Banner{ID: id, Message: message, Level: level, Starts: starts.UTC(), Ends: ends.UTC()}
+	return id, nil
+}
+
+func (m *MemoryBannerModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.banners[id]; !ok {
+		return ErrNoRecord
+	}
+	delete(m.banners, id)
+	return nil
+}
+
+func (m *MemoryBannerModel) Active() ([]Banner, error) {
+	now := time.Now()
+	return m.filter(func(b Banner) bool { return b.ActiveAt(now) }), nil
+}
+
+func (m *MemoryBannerModel) All() ([]Banner, error) {
+	now := time.Now()
+	banners := m.filter(func(b Banner) bool { return b.Ends.After(now) })
+	slices.SortStableFunc(banners, func(a, b Banner) int { return a.Starts.Compare(b.Starts) })
+	return banners, nil
+}
+
+// Return the banners matching keep, oldest first.
+func (m *MemoryBannerModel) filter(keep func(Banner) bool) []Banner {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var banners []Banner
+	for _, b := range m.banners {
+		if keep(b) {
+			banners = append(banners, b)
+		}
+	}
+	slices.SortFunc(banners, func(a, b Banner) int { return cmp.Compare(a.ID, b.ID) })
+	return banners
+}
+
+type fileBanner struct {
+	ID      int       `json:"id"`
+	Message string    `json:"message"`
+	Level   string    `json:"level"`
+	Starts  time.Time `json:"starts"`
+	Ends    time.Time `json:"ends"`
+}
+
+// FileBannerModel keeps banners in memory and rewrites a single JSON file
+// on every change.
+type FileBannerModel struct {
+	*MemoryBannerModel
+
+	path string
+	mu   sync.Mutex
+}
+
+func OpenFileBannerModel(path string) (*FileBannerModel, error) {
+	m := &FileBannerModel{MemoryBannerModel: NewMemoryBannerModel(), path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var banners []fileBanner
+	if err := json.Unmarshal(b, &banners); err != nil {
+		return nil, err
+	}
+	for _, b := range banners {
+		m.banners[b.ID] = Banner(b)
+		m.nextID = max(m.nextID, b.ID+1)
+	}
+
+	return m, nil
+}
+
+func (m *FileBannerModel) Insert(message, level string, starts, ends time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, err := m.MemoryBannerModel.Insert(message, level, starts, ends)
+	if err != nil {
+		return 0, err
+	}
+	return id, m.save()
+}
+
+func (m *FileBannerModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.MemoryBannerModel.Delete(id); err != nil {
+		return err
+	}
+	return m.save()
+}
+
+func (m *FileBannerModel) save() error {
+	var banners []fileBanner
+	for _, b := range m.filter(func(Banner) bool { return true }) {
+		banners = append(banners, fileBanner(b))
+	}
+
+	b, err := json.MarshalIndent(banners, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, b)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Characters of content OpenContent reads from MySQL at a time, up to
+// 256KB with four-byte characters.
+const contentChunkChars = 64 << 10
+
+// ErrContentChanged is returned by a content reader when the snippet is
+// edited or deleted part way through reading it.
+var ErrContentChanged = errors.New("models: snippet changed while being read")
+
+// OpenContent returns a snippet's summary, as in listings, and a reader
+// for its content, so a large snippet can be sent without holding all of
+// it in memory. Expired snippets give ErrExpired, as with Get. The reader
+// must be closed.
+//
+// The content is read a chunk at a time, each in its own query through
+// the replica and the breaker, so no connection is held while the client
+// downloads. Each chunk is read only from the version the summary came
+// from; an edit made meanwhile makes the reader fail with
+// ErrContentChanged rather than mix versions.
+func (m *SnippetModel) OpenContent(id int) (Snippet, io.ReadCloser, error) {
+	defer m.timed("open_content")()
+
+	stmt := `SELECT ` + summaryColumns + `, expires > UTC_TIMESTAMP() FROM snippets WHERE id = ?`
+
+	var (
+		s    Snippet
+		live bool
+	)
+	err := m.queryRow(stmt, []any{id}, &s.ID, &s.Title, &s.Excerpt, &s.Bytes, &s.Lines, &s.Words, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata, &live)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, nil, ErrNoRecord
+		}
+		return Snippet{}, nil, err
+	}
+	if !live {
+		return s.expiredStub(), nil, ErrExpired
+	}
+	s.Excerpt = Truncate(s.Excerpt, ExcerptLength)
+
+	return s, &contentReader{m: m, id: id, version: s.Version, pos: 1}, nil
+}
+
+// contentReader reads a snippet's content a chunk at a time with
+// SUBSTRING, which counts characters from 1.
+type contentReader struct {
+	m       *SnippetModel
+	id      int
+	version int
+	pos     int
+	chunk   strings.Reader
+	done    bool
+}
+
+func (r *contentReader) Read(p []byte) (int, error) {
+	for r.chunk.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		var chunk string
+		err := r.m.queryRow(`SELECT SUBSTRING(content, ?, ?) FROM snippets WHERE id = ? AND version = ?`, []any{r.pos, contentChunkChars, r.id, r.version}, &chunk)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrContentChanged
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.pos += contentChunkChars
+		r.done = chunk == ""
+		r.chunk.Reset(chunk)
+	}
+	return r.chunk.Read(p)
+}
+
+func (r *contentReader) Close() error {
+	return nil
+}
+
+// The memory and file backends already hold the content, so there's
+// nothing to stream from.
+func (m *MemorySnippetModel) OpenContent(id int) (Snippet, io.ReadCloser, error) {
+	s, err := m.Get(id)
+	if err != nil {
+		return s, nil, err
+	}
+	return s.Summary(), io.NopCloser(strings.NewReader(s.Content)), nil
+}
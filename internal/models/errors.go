@@ -1,5 +1,56 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
 
 var ErrNoRecord = errors.New("models: no matching record found")
+
+var ErrUnavailable = errors.New("models: database temporarily unavailable")
+
+var ErrInvalidExpiry = errors.New("models: invalid expiry")
+
+// ErrInvalidMetadata means a metadata key isn't one ValidMetadataKey
+// accepts.
+var ErrInvalidMetadata = errors.New("models: invalid metadata")
+
+// ErrDuplicate means a write collided with a unique key.
+var ErrDuplicate = errors.New("models: duplicate record")
+
+// ErrTooLong means a value didn't fit its column.
+var ErrTooLong = errors.New("models: value too long")
+
+// ErrEditConflict means an update was based on an old version of the
+// record, which someone else has changed since.
+var ErrEditConflict = errors.New("models: edit conflict")
+
+// ErrExpired means the record exists but has expired. It wraps ErrNoRecord,
+// so callers that don't care about the difference can keep checking for
+// that.
+var ErrExpired = fmt.Errorf("%w: expired", ErrNoRecord)
+
+// MySQL server error numbers translated by dbError.
+const (
+	mysqlDuplicateEntry = 1062
+	mysqlDataTooLong    = 1406
+)
+
+// Wrap MySQL errors that callers can act on in the matching model error.
+// The driver error stays in the chain for logging.
+func dbError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err
+	}
+
+	switch mysqlErr.Number {
+	case mysqlDuplicateEntry:
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	case mysqlDataTooLong:
+		return fmt.Errorf("%w: %w", ErrTooLong, err)
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventKind is what happened to a snippet.
+type EventKind string
+
+const (
+	EventCreated   EventKind = "created"
+	EventUpdated   EventKind = "updated"
+	EventPublished EventKind = "published"
+)
+
+// Event is one entry in the activity log. Title is copied from the
+// snippet when the event is recorded, so the log still reads well after
+// the snippet expires or is renamed.
+type Event struct {
+	ID        int
+	Kind      EventKind
+	SnippetID int
+	Title     string
+	Created   time.Time
+}
+
+type EventModelInterface interface {
+	Record(kind EventKind, snippetID int, title string) error
+	// Return the limit most recent events, newest first.
+	Recent(limit int) ([]Event, error)
+}
+
+type EventModel struct {
+	DB *sql.DB
+}
+
+func (m *EventModel) Record(kind EventKind, snippetID int, title string) error {
+	stmt := `INSERT INTO events (kind, snippet_id, title, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, kind, snippetID, title)
+	return err
+}
+
+func (m *EventModel) Recent(limit int) ([]Event, error) {
+	stmt := `SELECT id, kind, snippet_id, title, created FROM events ORDER BY id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+
+	for rows.Next() {
+		var e Event
+		err = rows.Scan(&e.ID, &e.Kind, &e.SnippetID, &e.Title, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Events kept by MemoryEventModel. Older ones are dropped.
+const maxMemoryEvents = 1000
+
+// MemoryEventModel keeps the latest events in process memory. The file
+// backend uses it too, so its activity log starts over on restart.
+type MemoryEventModel struct {
+	mu     sync.Mutex
+	events []Event
+	nextID int
+}
+
+func NewMemoryEventModel() *MemoryEventModel {
+	return &MemoryEventModel{nextID: 1}
+}
+
+func (m *MemoryEventModel) Record(kind EventKind, snippetID int, title string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, Event{ID: m.nextID, Kind: kind, SnippetID: snippetID, Title: title, Created: time.Now().UTC().Truncate(time.Second)})
+	m.nextID++
+	if len(m.events) > maxMemoryEvents {
+		m.events = slices.Delete(m.events, 0, len(m.events)-maxMemoryEvents)
+	}
+	return nil
+}
+
+func (m *MemoryEventModel) Recent(limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := slices.Clone(m.events[max(0, len(m.events)-limit):])
+	slices.Reverse(events)
+	return events, nil
+}
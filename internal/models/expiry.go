@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpiryPolicy is how long a deployment lets snippets live. It's checked
+// whenever a snippet's expiry is set, by Insert, Update and SetExpires.
+type ExpiryPolicy struct {
+	// The most days from now a snippet's expiry can be set to.
+	MaxDays int
+	// Whether snippets may be kept forever, by giving NeverExpires.
+	AllowNever bool
+}
+
+// NeverExpires, given in place of a number of days, keeps a snippet until
+// it's deleted.
+const NeverExpires = -1
+
+// The largest MaxDays, keeping expiries well inside what DATETIME holds.
+const MaxExpiryDays = 100 * 365
+
+// What's stored as the expiry of a snippet that never expires: the last
+// second a DATETIME holds.
+var neverExpiresAt = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// Check that a snippet may be set to expire days from now.
+func (p ExpiryPolicy) Check(days int) error {
+	if days == NeverExpires {
+		if !p.AllowNever {
+			return fmt.Errorf("%w: snippets must expire", ErrInvalidExpiry)
+		}
+		return nil
+	}
+	if days < 1 || days > p.MaxDays {
+		return fmt.Errorf("%w: must be between 1 and %d days", ErrInvalidExpiry, p.MaxDays)
+	}
+	return nil
+}
+
+// When a snippet set to expire days after now expires.
+func expiresAt(now time.Time, days int) time.Time {
+	if days == NeverExpires {
+		return neverExpiresAt
+	}
+	return now.AddDate(0, 0, days)
+}
+
+// SQL for the expiry of a snippet set to expire days from now, with its
+// arguments.
+const expiresSQL = "IF(? = ?, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))"
+
+func expiresArgs(days int) []any {
+	return []any{days, NeverExpires, neverExpiresAt, days}
+}
+
+// Permanent reports whether the snippet was set never to expire.
+func (s Snippet) Permanent() bool {
+	return !s.Expires.Before(neverExpiresAt)
+}
@@ -0,0 +1,289 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSnippetModel stores each snippet as a JSON file under dir/snippets,
+// plus dir/index.json recording the next id so ids are never reused and
+// dir/tombstones.json recording when purged snippets expired. All
+// snippets are loaded into memory at startup and every write goes to disk
+// before it returns, and is undone in memory if it can't be written, so
+// it suits small personal deployments.
+type FileSnippetModel struct {
+	*MemorySnippetModel
+
+	dir string
+	// Serialises writes so memory and disk are updated together.
+	mu sync.Mutex
+}
+
+type fileIndex struct {
+	NextID int `json:"next_id"`
+}
+
+type fileSnippet struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	// Missing in files written before scheduled publishing existed.
+	PublishAt time.Time `json:"publish_at"`
+	// Missing in files written before versioning existed.
+	Version int `json:"version,omitempty"`
+	// Zero in files written before it was tracked.
+	Updated  time.Time `json:"updated"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+}
+
+// Open the store in dir, creating it if needed, and load every snippet.
+func OpenFileSnippetModel(dir string) (*FileSnippetModel, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "snippets"), 0o755); err != nil {
+		return nil, err
+	}
+
+	m := &FileSnippetModel{MemorySnippetModel: NewMemorySnippetModel(), dir: dir}
+
+	var index fileIndex
+	b, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, fmt.Errorf("models: reading index.json: %w", err)
+		}
+	}
+	m.nextID = max(m.nextID, index.NextID)
+
+	b, err = os.ReadFile(filepath.Join(dir, "tombstones.json"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &m.tombstones); err != nil {
+			return nil, fmt.Errorf("models: reading tombstones.json: %w", err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "snippets", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var f fileSnippet
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("models: reading %s: %w", path, err)
+		}
+
+		s := Snippet{ID: f.ID, Title: f.Title, Content: f.Content, Language: f.Language, Created: f.Created, Expires: f.Expires, PublishAt: f.PublishAt, Version: max(f.Version, 1), Updated: f.Updated, Metadata: f.Metadata}
+		s.PublishAt = publishTime(s)
+		if s.Updated.IsZero() {
+			s.Updated = s.Created
+		}
+		s.fillDerived()
+		m.snippets[f.ID] = s
+		m.nextID = max(m.nextID, f.ID+1)
+	}
+
+	return m, nil
+}
+
+func (m *FileSnippetModel) Insert(title string, content string, language string, metadata Metadata, expires int, policy ExpiryPolicy, publishAt time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rollback := m.snapshot(m.nextID)
+	id, err := m.MemorySnippetModel.Insert(title, content, language, metadata, expires, policy, publishAt)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.persist(id); err != nil {
+		rollback()
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *FileSnippetModel) SetExpires(id int, days int, policy ExpiryPolicy, version int) error {
+	return m.Update(id, SnippetUpdate{Expires: &days}, policy, version)
+}
+
+func (m *FileSnippetModel) Update(id int, u SnippetUpdate, policy ExpiryPolicy, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rollback := m.snapshot(id)
+	if err := m.MemorySnippetModel.Update(id, u, policy, version); err != nil {
+		return err
+	}
+	if err := m.persist(id); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+func (m *FileSnippetModel) Restore(snippets []Snippet, overwrite, dryRun bool) (RestoreReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make([]int, len(snippets))
+	for i, s := range snippets {
+		all[i] = s.ID
+	}
+	rollback := m.snapshot(all...)
+
+	report, err := m.MemorySnippetModel.Restore(snippets, overwrite, dryRun)
+	if err != nil || dryRun {
+		return report, err
+	}
+
+	conflicts := map[int]bool{}
+	for _, id := range report.Conflicts {
+		conflicts[id] = true
+	}
+
+	var ids []int
+	for _, s := range snippets {
+		if !conflicts[s.ID] {
+			ids = append(ids, s.ID)
+		}
+	}
+
+	if err := m.persist(ids...); err != nil {
+		rollback()
+		return RestoreReport{}, err
+	}
+	return report, nil
+}
+
+func (m *FileSnippetModel) BulkInsert(snippets []Snippet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]int, len(snippets))
+	for i := range snippets {
+		ids[i] = m.nextID + i
+	}
+	rollback := m.snapshot(ids...)
+
+	if err := m.MemorySnippetModel.BulkInsert(snippets); err != nil {
+		return err
+	}
+	if err := m.persist(ids...); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// Remember the given snippets and the next id, and return a func that
+// puts them back, for when a change made in memory can't be written to
+// disk. Files already written for the change are put back too, as far as
+// that's possible; whatever stopped the write probably stops this.
+// Call it with m.mu held.
+func (m *FileSnippetModel) snapshot(ids ...int) (rollback func()) {
+	m.MemorySnippetModel.mu.RLock()
+	saved := map[int]Snippet{}
+	for _, id := range ids {
+		if s, ok := m.snippets[id]; ok {
+			saved[id] = s
+		}
+	}
+	nextID := m.nextID
+	m.MemorySnippetModel.mu.RUnlock()
+
+	return func() {
+		m.MemorySnippetModel.mu.Lock()
+		var existed []int
+		for _, id := range ids {
+			if s, ok := saved[id]; ok {
+				m.snippets[id] = s
+				existed = append(existed, id)
+			} else {
+				delete(m.snippets, id)
+				os.Remove(filepath.Join(m.dir, "snippets", strconv.Itoa(id)+".json"))
+			}
+		}
+		m.nextID = nextID
+		m.MemorySnippetModel.mu.Unlock()
+
+		m.persist(existed...)
+	}
+}
+
+// Write the given snippets and the index to disk.
+func (m *FileSnippetModel) persist(ids ...int) error {
+	m.MemorySnippetModel.mu.RLock()
+	defer m.MemorySnippetModel.mu.RUnlock()
+
+	for _, id := range ids {
+		s := m.snippets[id]
+		b, err := json.MarshalIndent(fileSnippet{ID: s.ID, Title: s.Title, Content: s.Content, Language: s.Language, Created: s.Created, Expires: s.Expires, PublishAt: s.PublishAt, Version: s.Version, Updated: s.Updated, Metadata: s.Metadata}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(m.dir, "snippets", strconv.Itoa(id)+".json"), b); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(fileIndex{NextID: m.nextID})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.dir, "index.json"), b)
+}
+
+// Write the purged snippets' expiry times to disk.
+func (m *FileSnippetModel) saveTombstones() error {
+	m.MemorySnippetModel.mu.RLock()
+	defer m.MemorySnippetModel.mu.RUnlock()
+
+	b, err := json.Marshal(m.tombstones)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.dir, "tombstones.json"), b)
+}
+
+// Write to a temporary file and rename it into place so readers never see
+// a partially written file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+strings.TrimSuffix(filepath.Base(path), ".json")+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,348 @@
+package models
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+	"snippety/internal/breaker"
+	"sync"
+	"time"
+)
+
+// Job is a unit of background work. Payload is opaque to the model; the
+// queue stores it as JSON.
+type Job struct {
+	ID      int
+	Kind    string
+	Payload []byte
+	// Attempts made so far, counting the current one once claimed.
+	Attempts int
+	// When the job is next due. While a worker holds it this is the end of
+	// its lease, after which another worker may take it over.
+	RunAt     time.Time
+	LastError string
+	// Dead jobs failed too often and are kept only for inspection.
+	Dead    bool
+	Created time.Time
+}
+
+// JobCounts is the queue's size, for metrics.
+type JobCounts struct {
+	// Jobs waiting to run or running.
+	Pending int
+	Dead    int
+}
+
+// Times are the database's, so servers whose clocks disagree still agree
+// on when a job is due and when a lease runs out.
+type JobModelInterface interface {
+	// Add a job that won't run before runAt, or, if runAt is zero, that is
+	// due now.
+	Enqueue(kind string, payload []byte, runAt time.Time) (int, error)
+	// Add a recurring job of the given kind, due now, unless there is one
+	// already.
+	EnqueueRecurring(kind string) error
+	// Take the next due job and hold it for lease. Returns ErrNoRecord when
+	// nothing is due.
+	Claim(lease time.Duration) (Job, error)
+	// Remove a job that succeeded.
+	Complete(id int) error
+	// Run a recurring job that succeeded again after delay, starting its
+	// attempts afresh.
+	Reschedule(id int, delay time.Duration) error
+	// Record a failure and retry after delay, or, if dead, give up on it.
+	Fail(id int, message string, delay time.Duration, dead bool) error
+	Counts() (JobCounts, error)
+	// Return up to limit dead jobs, most recent first.
+	DeadJobs(limit int) ([]Job, error)
+}
+
+type JobModel struct {
+	DB *sql.DB
+	// Shared with the snippet model; see guard.
+	Breaker *breaker.Breaker
+	Logger  *slog.Logger
+}
+
+func (m *JobModel) Enqueue(kind string, payload []byte, runAt time.Time) (int, error) {
+	stmt := `INSERT INTO jobs (kind, payload, attempts, run_at, last_error, dead, created)
+    VALUES (?, ?, 0, COALESCE(?, UTC_TIMESTAMP()), '', FALSE, UTC_TIMESTAMP())`
+
+	var at any
+	if !runAt.IsZero() {
+		at = runAt.UTC()
+	}
+
+	var id int64
+	err := guard(m.Breaker, m.Logger, func() error {
+		result, err := m.DB.Exec(stmt, kind, payload, at)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return int(id), nil
+}
+
+// The unique recurring_kind keeps servers starting together from adding
+// one each.
+func (m *JobModel) EnqueueRecurring(kind string) error {
+	stmt := `INSERT INTO jobs (kind, payload, attempts, run_at, last_error, dead, created, recurring_kind)
+    VALUES (?, 'null', 0, UTC_TIMESTAMP(), '', FALSE, UTC_TIMESTAMP(), ?)
+    ON DUPLICATE KEY UPDATE id = id`
+
+	return guard(m.Breaker, m.Logger, func() error {
+		_, err := m.DB.Exec(stmt, kind, kind)
+		return err
+	})
+}
+
+// Claim locks the oldest due job, skipping rows other workers have
+// locked, and pushes its run_at out by lease. A worker that dies leaves
+// the job to be claimed again once the lease runs out.
+func (m *JobModel) Claim(lease time.Duration) (Job, error) {
+	stmt := `SELECT id, kind, payload, attempts, last_error, created, UTC_TIMESTAMP() FROM jobs
+    WHERE dead = FALSE AND run_at <= UTC_TIMESTAMP() ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+	var j Job
+	err := guard(m.Breaker, m.Logger, func() error {
+		tx, err := m.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var now time.Time
+		err = tx.QueryRow(stmt).Scan(&j.ID, &j.Kind, &j.Payload, &j.Attempts, &j.LastError, &j.Created, &now)
+		if err != nil {
+			return err
+		}
+
+		j.Attempts++
+		j.RunAt = now.Add(lease).Truncate(time.Second)
+		_, err = tx.Exec(`UPDATE jobs SET attempts = ?, run_at = ? WHERE id = ?`, j.Attempts, j.RunAt, j.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNoRecord
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return j, nil
+}
+
+func (m *JobModel) Complete(id int) error {
+	return guard(m.Breaker, m.Logger, func() error {
+		_, err := m.DB.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+		return err
+	})
+}
+
+func (m *JobModel) Reschedule(id int, delay time.Duration) error {
+	stmt := `UPDATE jobs SET attempts = 0, last_error = '', run_at = UTC_TIMESTAMP() + INTERVAL ? SECOND WHERE id = ?`
+
+	return guard(m.Breaker, m.Logger, func() error {
+		_, err := m.DB.Exec(stmt, int64(delay.Seconds()), id)
+		return err
+	})
+}
+
+func (m *JobModel) Fail(id int, message string, delay time.Duration, dead bool) error {
+	stmt := `UPDATE jobs SET last_error = ?, run_at = UTC_TIMESTAMP() + INTERVAL ? SECOND, dead = ? WHERE id = ?`
+
+	return guard(m.Breaker, m.Logger, func() error {
+		_, err := m.DB.Exec(stmt, truncateError(message), int64(delay.Seconds()), dead, id)
+		return err
+	})
+}
+
+func (m *JobModel) Counts() (JobCounts, error) {
+	var c JobCounts
+	err := guard(m.Breaker, m.Logger, func() error {
+		return m.DB.QueryRow(`SELECT COALESCE(SUM(dead = FALSE), 0), COALESCE(SUM(dead = TRUE), 0) FROM jobs`).Scan(&c.Pending, &c.Dead)
+	})
+	return c, err
+}
+
+func (m *JobModel) DeadJobs(limit int) ([]Job, error) {
+	stmt := `SELECT id, kind, payload, attempts, run_at, last_error, dead, created FROM jobs
+    WHERE dead = TRUE ORDER BY run_at DESC, id DESC LIMIT ?`
+
+	var jobs []Job
+	err := guard(m.Breaker, m.Logger, func() error {
+		rows, err := m.DB.Query(stmt, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var j Job
+			err = rows.Scan(&j.ID, &j.Kind, &j.Payload, &j.Attempts, &j.RunAt, &j.LastError, &j.Dead, &j.Created)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, j)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Size of the last_error column in schema.sql.
+const maxJobErrorChars = 1000
+
+func truncateError(message string) string {
+	if r := []rune(message); len(r) > maxJobErrorChars {
+		return string(r[:maxJobErrorChars])
+	}
+	return message
+}
+
+// MemoryJobModel keeps the queue in process memory, so pending jobs are
+// lost on restart. The file backend uses it too.
+type MemoryJobModel struct {
+	mu     sync.Mutex
+	jobs   map[int]Job
+	nextID int
+	// The id of the recurring job of each kind.
+	recurring map[string]int
+}
+
+func NewMemoryJobModel() *MemoryJobModel {
+	return &MemoryJobModel{jobs: map[int]Job{}, nextID: 1, recurring: map[string]int{}}
+}
+
+func (m *MemoryJobModel) Enqueue(kind string, payload []byte, runAt time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	if runAt.IsZero() {
+		runAt = now
+	}
+	id := m.nextID
+	m.nextID++
+	m.jobs[id] = Job{ID: id, Kind: kind, Payload: payload, RunAt: runAt.UTC(), Created: now.Truncate(time.Second)}
+	return id, nil
+}
+
+func (m *MemoryJobModel) EnqueueRecurring(kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.jobs[m.recurring[kind]]; ok {
+		return nil
+	}
+	now := time.Now().UTC()
+	id := m.nextID
+	m.nextID++
+	m.jobs[id] = Job{ID: id, Kind: kind, Payload: []byte("null"), RunAt: now, Created: now.Truncate(time.Second)}
+	m.recurring[kind] = id
+	return nil
+}
+
+func (m *MemoryJobModel) Claim(lease time.Duration) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var due []Job
+	for _, j := range m.jobs {
+		if !j.Dead && !j.RunAt.After(now) {
+			due = append(due, j)
+		}
+	}
+	if len(due) == 0 {
+		return Job{}, ErrNoRecord
+	}
+
+	j := slices.MinFunc(due, func(a, b Job) int {
+		return cmp.Or(a.RunAt.Compare(b.RunAt), cmp.Compare(a.ID, b.ID))
+	})
+	j.Attempts++
+	j.RunAt = now.UTC().Add(lease)
+	m.jobs[j.ID] = j
+	return j, nil
+}
+
+func (m *MemoryJobModel) Complete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *MemoryJobModel) Reschedule(id int, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return ErrNoRecord
+	}
+	j.Attempts, j.LastError, j.RunAt = 0, "", time.Now().UTC().Add(delay)
+	m.jobs[id] = j
+	return nil
+}
+
+func (m *MemoryJobModel) Fail(id int, message string, delay time.Duration, dead bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return ErrNoRecord
+	}
+	j.LastError, j.RunAt, j.Dead = truncateError(message), time.Now().UTC().Add(delay), dead
+	m.jobs[id] = j
+	return nil
+}
+
+func (m *MemoryJobModel) Counts() (JobCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var c JobCounts
+	for _, j := range m.jobs {
+		if j.Dead {
+			c.Dead++
+		} else {
+			c.Pending++
+		}
+	}
+	return c, nil
+}
+
+func (m *MemoryJobModel) DeadJobs(limit int) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []Job
+	for _, j := range m.jobs {
+		if j.Dead {
+			jobs = append(jobs, j)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return cmp.Or(b.RunAt.Compare(a.RunAt), cmp.Compare(b.ID, a.ID))
+	})
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
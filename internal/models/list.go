@@ -0,0 +1,298 @@
+package models
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidListOptions = errors.New("models: invalid list options")
+
+// SnippetSort is the order of a listing.
+type SnippetSort string
+
+const (
+	SortNewest   SnippetSort = "newest"
+	SortOldest   SnippetSort = "oldest"
+	SortTitle    SnippetSort = "title"
+	SortExpiring SnippetSort = "expiring"
+	// Largest first.
+	SortLines SnippetSort = "lines"
+	SortWords SnippetSort = "words"
+	SortBytes SnippetSort = "bytes"
+)
+
+const (
+	DefaultListLimit = 10
+	MaxListLimit     = 100
+)
+
+// SnippetListOptions controls a List query. The zero value lists the 10
+// newest unexpired snippets, which is what the home page shows.
+type SnippetListOptions struct {
+	// Number of rows to return, capped at MaxListLimit. Zero means
+	// DefaultListLimit.
+	Limit  int
+	Offset int
+	// Only return snippets after the one with this id in the listing
+	// order, for keyset pagination. Only valid for SortNewest and
+	// SortOldest, and cannot be combined with Offset.
+	Cursor int
+	// Empty means SortNewest.
+	Sort   SnippetSort
+	Filter SnippetFilter
+	// Include expired snippets and ones not published yet. Only the admin
+	// area should set these.
+	IncludeExpired     bool
+	IncludeUnpublished bool
+	// Only return expired snippets, for the admin's archive.
+	OnlyExpired bool
+}
+
+// Fill in defaults and check the options are consistent.
+func (o SnippetListOptions) normalize() (SnippetListOptions, error) {
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	o.Limit = min(o.Limit, MaxListLimit)
+	if o.Sort == "" {
+		o.Sort = SortNewest
+	}
+
+	switch {
+	case o.Offset < 0 || o.Cursor < 0:
+		return o, fmt.Errorf("%w: offset and cursor must not be negative", ErrInvalidListOptions)
+	case o.Cursor > 0 && o.Offset > 0:
+		return o, fmt.Errorf("%w: use either a cursor or an offset", ErrInvalidListOptions)
+	}
+
+	switch o.Sort {
+	case SortNewest, SortOldest:
+	case SortTitle, SortExpiring, SortLines, SortWords, SortBytes:
+		if o.Cursor > 0 {
+			return o, fmt.Errorf("%w: a cursor can only be used when sorting by newest or oldest", ErrInvalidListOptions)
+		}
+	default:
+		return o, fmt.Errorf("%w: unknown sort %q", ErrInvalidListOptions, o.Sort)
+	}
+
+	return o, nil
+}
+
+// Report whether the options are cheap enough to cache: the unfiltered
+// first page, as the home page and the API's default listing request.
+func (o SnippetListOptions) cacheable() bool {
+	return o.Filter.Empty() && o.Offset == 0 && o.Cursor == 0 && !o.OnlyExpired
+}
+
+type listCacheKey struct {
+	limit              int
+	sort               SnippetSort
+	includeExpired     bool
+	includeUnpublished bool
+}
+
+var orderBySQL = map[SnippetSort]string{
+	SortNewest:   "id DESC",
+	SortOldest:   "id",
+	SortTitle:    "title, id DESC",
+	SortExpiring: "expires, id",
+	SortLines:    linesSQL + " DESC, id DESC",
+	SortWords:    "words DESC, id DESC",
+	SortBytes:    "LENGTH(content) DESC, id DESC",
+}
+
+// Build the WHERE clause (including the keyword, or empty) and its
+// arguments for a listing query.
+func (o SnippetListOptions) where() (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+
+	switch {
+	case o.OnlyExpired:
+		where = append(where, "expires <= UTC_TIMESTAMP()")
+	case !o.IncludeExpired:
+		where = append(where, "expires > UTC_TIMESTAMP()")
+	}
+	if !o.IncludeUnpublished {
+		where = append(where, "publish_at <= UTC_TIMESTAMP()")
+	}
+	for _, s := range slices.Concat(o.Filter.Terms, o.Filter.Phrases) {
+		where = append(where, "(title LIKE ? OR content LIKE ?)")
+		p := likePattern(s)
+		args = append(args, p, p)
+	}
+	if !o.Filter.Before.IsZero() {
+		where = append(where, "created < ?")
+		args = append(args, o.Filter.Before)
+	}
+	if !o.Filter.After.IsZero() {
+		where = append(where, "created >= ?")
+		args = append(args, o.Filter.After)
+	}
+	for _, key := range o.Filter.MetaKeys {
+		where = append(where, "JSON_CONTAINS_PATH(metadata, 'one', ?)")
+		args = append(args, metadataPath(key))
+	}
+	if o.Filter.Language != "" {
+		where = append(where, "language = ?")
+		args = append(args, o.Filter.Language)
+	}
+	if o.Cursor > 0 {
+		if o.Sort == SortOldest {
+			where = append(where, "id > ?")
+		} else {
+			where = append(where, "id < ?")
+		}
+		args = append(args, o.Cursor)
+	}
+
+	if len(where) == 0 {
+		return "", args
+	}
+	return `
+    WHERE ` + strings.Join(where, " AND "), args
+}
+
+// Build the statement and arguments for a listing query.
+func (o SnippetListOptions) sql() (string, []any) {
+	where, args := o.where()
+	stmt := `SELECT ` + summaryColumns + ` FROM snippets` + where +
+		` ORDER BY ` + orderBySQL[o.Sort] + ` LIMIT ? OFFSET ?`
+	return stmt, append(args, o.Limit, o.Offset)
+}
+
+// Return a page of snippets, without their content. While the database is
+// unavailable the last result for the first unfiltered page is served
+// instead, so the home page keeps working through an outage.
+func (m *SnippetModel) List(opts SnippetListOptions) ([]Snippet, error) {
+	defer m.timed("list")()
+
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+	key := listCacheKey{opts.Limit, opts.Sort, opts.IncludeExpired, opts.IncludeUnpublished}
+
+	stmt, args := opts.sql()
+	rows, err := m.query(stmt, args...)
+	if errors.Is(err, ErrUnavailable) && opts.cacheable() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if cached, ok := m.cache[key]; ok {
+			return cached, nil
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		s, err := scanSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.cacheable() {
+		m.mu.Lock()
+		if m.cache == nil {
+			m.cache = map[listCacheKey][]Snippet{}
+		}
+		m.cache[key] = snippets
+		m.mu.Unlock()
+	}
+
+	return snippets, nil
+}
+
+// ClearCache forgets the listings kept for outages, so none older than the
+// next successful query is served.
+func (m *SnippetModel) ClearCache() {
+	m.mu.Lock()
+	m.cache = nil
+	m.mu.Unlock()
+}
+
+// Count the snippets List would return across all pages. Limit, Offset,
+// Cursor and Sort are ignored.
+func (m *SnippetModel) Count(opts SnippetListOptions) (int, error) {
+	defer m.timed("count")()
+
+	opts.Cursor = 0
+	where, args := opts.where()
+
+	var n int
+	err := m.queryRow(`SELECT COUNT(*) FROM snippets`+where, args, &n)
+	return n, err
+}
+
+func (m *MemorySnippetModel) List(opts SnippetListOptions) ([]Snippet, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	snippets := m.matching(opts)
+
+	switch opts.Sort {
+	case SortOldest:
+		slices.Reverse(snippets)
+	case SortTitle:
+		slices.SortStableFunc(snippets, func(a, b Snippet) int {
+			return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		})
+	case SortExpiring:
+		slices.SortFunc(snippets, func(a, b Snippet) int {
+			return cmp.Or(a.Expires.Compare(b.Expires), cmp.Compare(a.ID, b.ID))
+		})
+	case SortLines, SortWords, SortBytes:
+		size := map[SnippetSort]func(Snippet) int{
+			SortLines: func(s Snippet) int { return countLines(s.Content) },
+			SortWords: func(s Snippet) int { return countWords(s.Content) },
+			SortBytes: func(s Snippet) int { return len(s.Content) },
+		}[opts.Sort]
+		// Stable, so equal sizes stay newest first.
+		slices.SortStableFunc(snippets, func(a, b Snippet) int { return cmp.Compare(size(b), size(a)) })
+	}
+
+	start := min(opts.Offset, len(snippets))
+	end := min(start+opts.Limit, len(snippets))
+	return summaries(snippets[start:end]), nil
+}
+
+func (m *MemorySnippetModel) Count(opts SnippetListOptions) (int, error) {
+	opts.Cursor = 0
+	return len(m.matching(opts)), nil
+}
+
+// Return the snippets matching the options' filters, newest first.
+func (m *MemorySnippetModel) matching(opts SnippetListOptions) []Snippet {
+	return m.filter(func(s Snippet) bool {
+		switch {
+		case opts.OnlyExpired && live(s):
+			return false
+		case !opts.IncludeExpired && !opts.OnlyExpired && !live(s):
+			return false
+		case !opts.IncludeUnpublished && !s.Published():
+			return false
+		case opts.Cursor > 0 && opts.Sort == SortOldest:
+			return s.ID > opts.Cursor && opts.Filter.Matches(s)
+		case opts.Cursor > 0:
+			return s.ID < opts.Cursor && opts.Filter.Matches(s)
+		}
+		return opts.Filter.Matches(s)
+	})
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MemorySnippetModel keeps snippets in process memory. It exists so the app
+// can run without a database for demos; everything is lost on restart.
+type MemorySnippetModel struct {
+	mu       sync.RWMutex
+	snippets map[int]Snippet
+	nextID   int
+	// When each purged snippet expired, for Changes.
+	tombstones map[int]time.Time
+}
+
+func NewMemorySnippetModel() *MemorySnippetModel {
+	return &MemorySnippetModel{snippets: map[int]Snippet{}, nextID: 1, tombstones: map[int]time.Time{}}
+}
+
+func (m *MemorySnippetModel) Insert(title string, content string, language string, metadata Metadata, expires int, policy ExpiryPolicy, publishAt time.Time) (int, error) {
+	if err := policy.Check(expires); err != nil {
+		return 0, err
+	}
+	if err := metadata.check(); err != nil {
+		return 0, err
+	}
+	if utf8.RuneCountInString(title) > MaxTitleChars || len(content) > MaxContentBytes {
+		return 0, ErrTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	id := m.nextID
+	m.nextID++
+
+	s := Snippet{ID: id, Title: title, Content: content, Language: language, Metadata: metadata.clone(), Created: now, Expires: expiresAt(now, expires), PublishAt: now, Version: 1, Updated: now}
+	if !publishAt.IsZero() {
+		s.PublishAt = publishAt.UTC()
+	}
+	s.fillDerived()
+	m.snippets[id] = s
+	return id, nil
+}
+
+func (m *MemorySnippetModel) Get(id int) (Snippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.snippets[id]
+	if !ok {
+		return Snippet{}, ErrNoRecord
+	}
+	if !live(s) {
+		return s.expiredStub(), ErrExpired
+	}
+	return s, nil
+}
+
+// There's no replica to lag, so GetLatest is Get.
+func (m *MemorySnippetModel) GetLatest(id int) (Snippet, error) {
+	return m.Get(id)
+}
+
+func (m *MemorySnippetModel) SetExpires(id int, days int, policy ExpiryPolicy, version int) error {
+	return m.Update(id, SnippetUpdate{Expires: &days}, policy, version)
+}
+
+func (m *MemorySnippetModel) Update(id int, u SnippetUpdate, policy ExpiryPolicy, version int) error {
+	if err := u.check(policy); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok {
+		return ErrNoRecord
+	}
+	if !live(s) && u.Expires == nil {
+		return ErrExpired
+	}
+	if s.Version != version {
+		return ErrEditConflict
+	}
+
+	if u.Title != nil {
+		s.Title = *u.Title
+	}
+	if u.Content != nil {
+		s.Content = *u.Content
+	}
+	if u.Language != nil {
+		s.Language = *u.Language
+	}
+	if u.Metadata != nil {
+		s.Metadata = u.Metadata.clone()
+	}
+	if u.Expires != nil {
+		s.Expires = expiresAt(time.Now().UTC().Truncate(time.Second), *u.Expires)
+	}
+	s.Version++
+	s.Updated = time.Now().UTC().Truncate(time.Second)
+	s.fillDerived()
+	m.snippets[id] = s
+	return nil
+}
+
+func (m *MemorySnippetModel) Search(f SnippetFilter) ([]Snippet, error) {
+	return m.List(SnippetListOptions{Filter: f, Limit: 50})
+}
+
+func summaries(snippets []Snippet) []Snippet {
+	for i, s := range snippets {
+		snippets[i] = s.Summary()
+	}
+	return snippets
+}
+
+func (m *MemorySnippetModel) Page(after, limit int) ([]Snippet, error) {
+	snippets := m.filter(func(s Snippet) bool { return s.ID > after && live(s) })
+	slices.Reverse(snippets)
+	return snippets[:min(len(snippets), limit)], nil
+}
+
+func (m *MemorySnippetModel) GetMany(ids []int) ([]Snippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var snippets []Snippet
+	for _, id := range ids {
+		if s, ok := m.snippets[id]; ok && live(s) {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *MemorySnippetModel) Export() ([]Snippet, error) {
+	snippets := m.filter(func(Snippet) bool { return true })
+	slices.Reverse(snippets)
+	return snippets, nil
+}
+
+func (m *MemorySnippetModel) Restore(snippets []Snippet, overwrite, dryRun bool) (RestoreReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var report RestoreReport
+	writes := map[int]Snippet{}
+
+	for _, s := range snippets {
+		existing, ok := m.snippets[s.ID]
+		switch {
+		case !ok:
+			writes[s.ID] = s
+			report.Inserted++
+		case sameSnippet(existing, s):
+			report.Unchanged++
+		case overwrite:
+			writes[s.ID] = s
+			report.Replaced++
+		default:
+			report.Conflicts = append(report.Conflicts, s.ID)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for id, s := range writes {
+		s.Version = m.snippets[id].Version + 1
+		s.Updated = now
+		s.PublishAt = publishTime(s)
+		s.Metadata = s.Metadata.clone()
+		s.fillDerived()
+		m.snippets[id] = s
+		m.nextID = max(m.nextID, id+1)
+	}
+	return report, nil
+}
+
+func (m *MemorySnippetModel) BulkInsert(snippets []Snippet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, s := range snippets {
+		s.ID = m.nextID
+		s.Version = 1
+		s.Updated = now
+		s.PublishAt = publishTime(s)
+		s.fillDerived()
+		m.nextID++
+		m.snippets[s.ID] = s
+	}
+	return nil
+}
+
+// Return the snippets matching keep, newest first.
+func (m *MemorySnippetModel) filter(keep func(Snippet) bool) []Snippet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var snippets []Snippet
+	for _, s := range m.snippets {
+		if keep(s) {
+			snippets = append(snippets, s)
+		}
+	}
+	slices.SortFunc(snippets, func(a, b Snippet) int { return cmp.Compare(b.ID, a.ID) })
+	return snippets
+}
+
+func live(s Snippet) bool {
+	return !s.Expired()
+}
+
+// Matches reports whether s satisfies the filter, comparing text
+// case-insensitively like the MySQL collation does.
+func (f SnippetFilter) Matches(s Snippet) bool {
+	if !f.Before.IsZero() && !s.Created.Before(f.Before) {
+		return false
+	}
+	if !f.After.IsZero() && s.Created.Before(f.After) {
+		return false
+	}
+	if !s.Metadata.HasKeys(f.MetaKeys) {
+		return false
+	}
+	if f.Language != "" && !strings.EqualFold(s.Language, f.Language) {
+		return false
+	}
+
+	title, content := strings.ToLower(s.Title), strings.ToLower(s.Content)
+	for _, t := range slices.Concat(f.Terms, f.Phrases) {
+		t = strings.ToLower(t)
+		if !strings.Contains(title, t) && !strings.Contains(content, t) {
+			return false
+		}
+	}
+	return true
+}
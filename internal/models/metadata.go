@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+)
+
+// Metadata is small key/value data a client attaches to a snippet, such
+// as the host it was pasted from or the CI job that made it. It's stored
+// as a JSON object, or NULL when empty, and can be searched by key with
+// the meta: operator.
+type Metadata map[string]string
+
+// Limits on Metadata, enforced by every backend: at most MaxMetadataKeys
+// keys, each matching metadataKeyRx, and at most MaxMetadataBytes once
+// encoded as JSON.
+const (
+	MaxMetadataKeys  = 16
+	MaxMetadataBytes = 2048
+)
+
+var metadataKeyRx = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidMetadataKey reports whether k can be used as a metadata key: 1 to
+// 64 letters, digits, underscores or hyphens.
+func ValidMetadataKey(k string) bool {
+	return metadataKeyRx.MatchString(k)
+}
+
+func (m Metadata) check() error {
+	for k := range m {
+		if !ValidMetadataKey(k) {
+			return fmt.Errorf("%w: key %q", ErrInvalidMetadata, k)
+		}
+	}
+	if len(m) > MaxMetadataKeys {
+		return ErrTooLong
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxMetadataBytes {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// Value stores m as a JSON object, or NULL when it's empty.
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan reads a JSON object written by Value.
+func (m *Metadata) Scan(src any) error {
+	*m = nil
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, m)
+	case string:
+		return json.Unmarshal([]byte(src), m)
+	}
+	return fmt.Errorf("models: cannot scan %T into Metadata", src)
+}
+
+// HasKeys reports whether m has every one of the keys.
+func (m Metadata) HasKeys(keys []string) bool {
+	for _, k := range keys {
+		if _, ok := m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// A copy for the memory backend to keep, so callers can't change stored
+// snippets through the map they passed in.
+func (m Metadata) clone() Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	return maps.Clone(m)
+}
+
+// JSON path to a key. Keys are checked with ValidMetadataKey first, so
+// they need no escaping.
+func metadataPath(key string) string {
+	return `$."` + key + `"`
+}
@@ -0,0 +1,271 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// A change made to schema.sql since the first release, which databases
+// created before it need applying. Each checks whether it's needed, so
+// migrating can be run again safely and on databases of any age.
+type migration struct {
+	name   string
+	needed func(db *sql.DB) (bool, error)
+	// Optional, for changes SQL can't make; run before stmts.
+	fill  func(db *sql.DB) error
+	stmts []string
+}
+
+var migrations = []migration{
+	{
+		name:   "add snippets.publish_at",
+		needed: missingColumn("snippets", "publish_at"),
+		stmts: []string{
+			`ALTER TABLE snippets ADD COLUMN publish_at DATETIME NULL`,
+			`UPDATE snippets SET publish_at = created`,
+			`ALTER TABLE snippets MODIFY publish_at DATETIME NOT NULL`,
+			`CREATE INDEX idx_snippets_publish_at ON snippets(publish_at)`,
+		},
+	},
+	{
+		name:   "add snippets.language",
+		needed: missingColumn("snippets", "language"),
+		stmts:  []string{`ALTER TABLE snippets ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT ''`},
+	},
+	{
+		name:   "add snippets.version",
+		needed: missingColumn("snippets", "version"),
+		stmts:  []string{`ALTER TABLE snippets ADD COLUMN version INTEGER NOT NULL DEFAULT 1`},
+	},
+	{
+		// Existing snippets count as last changed when they were created,
+		// as in the file backend.
+		name:   "add snippets.updated",
+		needed: missingColumn("snippets", "updated"),
+		stmts: []string{
+			`ALTER TABLE snippets ADD COLUMN updated DATETIME NULL`,
+			`UPDATE snippets SET updated = created`,
+			`ALTER TABLE snippets MODIFY updated DATETIME NOT NULL`,
+			`CREATE INDEX idx_snippets_updated ON snippets(updated)`,
+		},
+	},
+	{
+		name:   "add snippets.metadata",
+		needed: missingColumn("snippets", "metadata"),
+		stmts:  []string{`ALTER TABLE snippets ADD COLUMN metadata JSON NULL`},
+	},
+	{
+		// TEXT holds 65535 bytes. Left alone, a larger -max-content-bytes
+		// would have MySQL reject or, outside strict mode, cut off content.
+		name: "widen snippets.content to MEDIUMTEXT",
+		needed: func(db *sql.DB) (bool, error) {
+			n, err := contentColumnBytes(db)
+			return n < MaxContentBytes, err
+		},
+		stmts: []string{`ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL`},
+	},
+	{
+		// Left NULL until counted, so a migration cut short carries on
+		// with the rows it didn't reach.
+		name:   "add snippets.words",
+		needed: missingColumn("snippets", "words"),
+		stmts:  []string{`ALTER TABLE snippets ADD COLUMN words INTEGER NULL`},
+	},
+	{
+		name:   "count words in existing snippets",
+		needed: nullableColumn("snippets", "words"),
+		fill:   fillWords,
+		stmts:  []string{`ALTER TABLE snippets MODIFY words INTEGER NOT NULL DEFAULT 0`},
+	},
+	{
+		// Title suggestions match prefixes, which this index serves.
+		name:   "index snippets.title",
+		needed: missingIndex("snippets", "idx_snippets_title"),
+		stmts:  []string{`CREATE INDEX idx_snippets_title ON snippets(title)`},
+	},
+	{
+		name:   "add snippets.changed_at",
+		needed: missingColumn("snippets", "changed_at"),
+		stmts: []string{
+			`ALTER TABLE snippets ADD COLUMN changed_at DATETIME AS (GREATEST(updated, publish_at)) STORED`,
+			`CREATE INDEX idx_snippets_changed_at ON snippets(changed_at, id)`,
+		},
+	},
+	{
+		name:   "add jobs.recurring_kind",
+		needed: missingColumn("jobs", "recurring_kind"),
+		stmts:  []string{`ALTER TABLE jobs ADD COLUMN recurring_kind VARCHAR(50) NULL UNIQUE`},
+	},
+}
+
+// How many bytes snippets.content holds.
+func contentColumnBytes(db *sql.DB) (int64, error) {
+	var n int64
+	err := db.QueryRow(`SELECT character_octet_length FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'snippets' AND column_name = 'content'`).Scan(&n)
+	return n, err
+}
+
+// ContentColumnBytes returns the most content the snippets table can hold,
+// which is less than MaxContentBytes until an older database is migrated.
+func (s *MySQLStorage) ContentColumnBytes() (int64, error) {
+	return contentColumnBytes(s.snippets.DB)
+}
+
+func missingColumn(table, column string) func(db *sql.DB) (bool, error) {
+	return func(db *sql.DB) (bool, error) {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`, table, column).Scan(&n)
+		return n == 0, err
+	}
+}
+
+func missingIndex(table, index string) func(db *sql.DB) (bool, error) {
+	return func(db *sql.DB) (bool, error) {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`, table, index).Scan(&n)
+		return n == 0, err
+	}
+}
+
+func nullableColumn(table, column string) func(db *sql.DB) (bool, error) {
+	return func(db *sql.DB) (bool, error) {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ? AND is_nullable = 'YES'`, table, column).Scan(&n)
+		return n > 0, err
+	}
+}
+
+// Count the words of snippets that have no count yet, 500 at a time.
+func fillWords(db *sql.DB) error {
+	for {
+		rows, err := db.Query(`SELECT id, content FROM snippets WHERE words IS NULL ORDER BY id LIMIT 500`)
+		if err != nil {
+			return err
+		}
+		counts := map[int]int{}
+		for rows.Next() {
+			var (
+				id      int
+				content string
+			)
+			if err := rows.Scan(&id, &content); err != nil {
+				rows.Close()
+				return err
+			}
+			counts[id] = countWords(content)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(counts) == 0 {
+			return nil
+		}
+
+		for id, n := range counts {
+			if _, err := db.Exec(`UPDATE snippets SET words = ? WHERE id = ?`, n, id); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PendingMigrations returns what Migrate would do: the tables it would
+// create and the changes it would make to existing ones.
+func (s *MySQLStorage) PendingMigrations() ([]string, error) {
+	missing, err := s.MissingTables()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, table := range missing {
+		pending = append(pending, "create "+table)
+	}
+	for _, m := range migrations {
+		if slices.Contains(missing, migrationTable(m)) {
+			continue
+		}
+		needed, err := m.needed(s.snippets.DB)
+		if err != nil {
+			return nil, err
+		}
+		if needed {
+			pending = append(pending, m.name)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate brings a database created by an older version up to date with
+// schema.sql, creating missing tables and adding missing columns, and
+// returns what it did. Like InitSchema, it can't run in a transaction,
+// so a failure part way leaves the changes made so far in place; running
+// it again carries on from there.
+func (s *MySQLStorage) Migrate() ([]string, error) {
+	missing, err := s.MissingTables()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, table := range missing {
+		for _, stmt := range schemaStatements() {
+			if statementTable(stmt) != table {
+				continue
+			}
+			if _, err := s.snippets.DB.Exec(stmt); err != nil {
+				return done, fmt.Errorf("models: creating %s: %w", table, err)
+			}
+		}
+		done = append(done, "create "+table)
+	}
+
+	for _, m := range migrations {
+		// A table just created from schema.sql is already current.
+		if slices.Contains(missing, migrationTable(m)) {
+			continue
+		}
+		needed, err := m.needed(s.snippets.DB)
+		if err != nil {
+			return done, err
+		}
+		if !needed {
+			continue
+		}
+		if m.fill != nil {
+			if err := m.fill(s.snippets.DB); err != nil {
+				return done, fmt.Errorf("models: %s: %w", m.name, err)
+			}
+		}
+		for _, stmt := range m.stmts {
+			if _, err := s.snippets.DB.Exec(stmt); err != nil {
+				return done, fmt.Errorf("models: %s: %w", m.name, err)
+			}
+		}
+		done = append(done, m.name)
+	}
+	return done, nil
+}
+
+var statementTableRx = regexp.MustCompile(`(?i)^(?:CREATE TABLE (\w+)|CREATE INDEX \w+ ON (\w+)|ALTER TABLE (\w+)|UPDATE (\w+))`)
+
+// The table a schema or migration statement works on.
+func statementTable(stmt string) string {
+	m := statementTableRx.FindStringSubmatch(stmt)
+	if m == nil {
+		return ""
+	}
+	for _, name := range m[1:] {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func migrationTable(m migration) string {
+	return statementTable(m.stmts[0])
+}
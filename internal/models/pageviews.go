@@ -0,0 +1,228 @@
+package models
+
+import (
+	"cmp"
+	"database/sql"
+	"log/slog"
+	"slices"
+	"snippety/internal/breaker"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxPagePathChars is the size of page_views.path. Longer paths are cut
+// short before they're recorded.
+const MaxPagePathChars = 255
+
+// PageViewCount is the traffic to one path over a report's range.
+// Uniques is the sum of each day's distinct visitors, since visitor
+// hashes change every day and can't be matched across days.
+type PageViewCount struct {
+	Path    string
+	Views   int
+	Uniques int
+}
+
+// PageViewTally is a number of views of a path on a day by one visitor,
+// an opaque hash that must not identify anyone. Views are counted in
+// memory and added in batches, so serving a page never waits on a write.
+type PageViewTally struct {
+	Day     time.Time
+	Path    string
+	Visitor string
+	Views   int
+}
+
+type PageViewModelInterface interface {
+	// Add the tallies to the stored counts and return how many were
+	// added. They're added in order, so on an error the rest, from that
+	// many on, weren't.
+	Add(tallies []PageViewTally) (int, error)
+	// Return the limit most viewed paths over the last days days, most
+	// viewed first.
+	Report(days, limit int) ([]PageViewCount, error)
+	// Return the views on each of the last days days, oldest first,
+	// including days with none.
+	PerDay(days int) ([]DayCount, error)
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func truncatePath(path string) string {
+	if len(path) <= MaxPagePathChars {
+		return path
+	}
+	n := MaxPagePathChars
+	for n > 0 && !utf8.RuneStart(path[n]) {
+		n--
+	}
+	return path[:n]
+}
+
+// PageViewModel stores a view counter per day, path and visitor, so
+// uniques are the row count and views the sum.
+type PageViewModel struct {
+	DB *sql.DB
+	// Shared with the snippet model; see guard.
+	Breaker *breaker.Breaker
+	Logger  *slog.Logger
+}
+
+// Rows per INSERT when adding tallies.
+const pageViewBatch = 500
+
+// Each batch is committed on its own, so a failure part way leaves the
+// batches before it added.
+func (m *PageViewModel) Add(tallies []PageViewTally) (int, error) {
+	var added int
+	for len(tallies) > 0 {
+		n := min(len(tallies), pageViewBatch)
+
+		args := make([]any, 0, 4*n)
+		for _, t := range tallies[:n] {
+			args = append(args, t.Day, truncatePath(t.Path), t.Visitor, t.Views)
+		}
+		stmt := `INSERT INTO page_views (day, path, visitor, views) VALUES ` +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?), ", n), ", ") + `
+    ON DUPLICATE KEY UPDATE views = views + VALUES(views)`
+
+		err := guard(m.Breaker, m.Logger, func() error {
+			_, err := m.DB.Exec(stmt, args...)
+			return err
+		})
+		if err != nil {
+			return added, err
+		}
+		added += n
+		tallies = tallies[n:]
+	}
+	return added, nil
+}
+
+func (m *PageViewModel) Report(days, limit int) ([]PageViewCount, error) {
+	stmt := `SELECT path, SUM(views), COUNT(*) FROM page_views WHERE day >= ?
+    GROUP BY path ORDER BY SUM(views) DESC, path LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, today().AddDate(0, 0, 1-days), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []PageViewCount
+
+	for rows.Next() {
+		var c PageViewCount
+		err = rows.Scan(&c.Path, &c.Views, &c.Uniques)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (m *PageViewModel) PerDay(days int) ([]DayCount, error) {
+	perDay := lastDays(days)
+
+	var rows *sql.Rows
+	err := guard(m.Breaker, m.Logger, func() (err error) {
+		rows, err = m.DB.Query(`SELECT day, SUM(views) FROM page_views WHERE day >= ? GROUP BY day`, perDay[0].Day)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			day time.Time
+			n   int
+		)
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		addDay(perDay, day, n)
+	}
+	return perDay, rows.Err()
+}
+
+type pageViewKey struct {
+	day     time.Time
+	path    string
+	visitor string
+}
+
+// MemoryPageViewModel keeps page views in process memory. The file
+// backend uses it too, so its analytics start over on restart.
+type MemoryPageViewModel struct {
+	mu    sync.Mutex
+	views map[pageViewKey]int
+}
+
+func NewMemoryPageViewModel() *MemoryPageViewModel {
+	return &MemoryPageViewModel{views: map[pageViewKey]int{}}
+}
+
+func (m *MemoryPageViewModel) Add(tallies []PageViewTally) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range tallies {
+		m.views[pageViewKey{t.Day.UTC().Truncate(24 * time.Hour), truncatePath(t.Path), t.Visitor}] += t.Views
+	}
+	return len(tallies), nil
+}
+
+func (m *MemoryPageViewModel) Report(days, limit int) ([]PageViewCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since := today().AddDate(0, 0, 1-days)
+	byPath := map[string]*PageViewCount{}
+	for k, n := range m.views {
+		if k.day.Before(since) {
+			continue
+		}
+		c, ok := byPath[k.path]
+		if !ok {
+			c = &PageViewCount{Path: k.path}
+			byPath[k.path] = c
+		}
+		c.Views += n
+		c.Uniques++
+	}
+
+	counts := make([]PageViewCount, 0, len(byPath))
+	for _, c := range byPath {
+		counts = append(counts, *c)
+	}
+	slices.SortFunc(counts, func(a, b PageViewCount) int {
+		return cmp.Or(cmp.Compare(b.Views, a.Views), cmp.Compare(a.Path, b.Path))
+	})
+	if len(counts) > limit {
+		counts = counts[:limit]
+	}
+
+	return counts, nil
+}
+
+func (m *MemoryPageViewModel) PerDay(days int) ([]DayCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	perDay := lastDays(days)
+	for k, n := range m.views {
+		addDay(perDay, k.day, n)
+	}
+	return perDay, nil
+}
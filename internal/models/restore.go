@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"maps"
+)
+
+// RestoreReport summarises what Restore did (or would do, on a dry run).
+type RestoreReport struct {
+	Inserted  int
+	Unchanged int
+	Replaced  int
+	// IDs of snippets that already exist with different data and were left
+	// alone because overwrite was not requested.
+	Conflicts []int
+}
+
+// Restore snippets with their original ids inside a single transaction.
+// Existing rows that differ are reported as conflicts unless overwrite is
+// set. With dryRun the transaction is rolled back after the report is
+// built.
+func (m *SnippetModel) Restore(snippets []Snippet, overwrite, dryRun bool) (RestoreReport, error) {
+	var report RestoreReport
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	for _, s := range snippets {
+		var existing Snippet
+		err := tx.QueryRow(`SELECT id, title, content, language, created, expires, publish_at, metadata FROM snippets WHERE id = ? FOR UPDATE`, s.ID).
+			Scan(&existing.ID, &existing.Title, &existing.Content, &existing.Language, &existing.Created, &existing.Expires, &existing.PublishAt, &existing.Metadata)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.Exec(`INSERT INTO snippets (id, title, content, words, language, created, expires, publish_at, metadata, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`,
+				s.ID, s.Title, s.Content, countWords(s.Content), s.Language, s.Created, s.Expires, publishTime(s), s.Metadata)
+			if err != nil {
+				return report, dbError(err)
+			}
+			report.Inserted++
+		case err != nil:
+			return report, err
+		case sameSnippet(existing, s):
+			report.Unchanged++
+		case overwrite:
+			_, err = tx.Exec(`UPDATE snippets SET title = ?, content = ?, words = ?, language = ?, created = ?, expires = ?, publish_at = ?, metadata = ?, version = version + 1, updated = UTC_TIMESTAMP() WHERE id = ?`,
+				s.Title, s.Content, countWords(s.Content), s.Language, s.Created, s.Expires, publishTime(s), s.Metadata, s.ID)
+			if err != nil {
+				return report, dbError(err)
+			}
+			report.Replaced++
+		default:
+			report.Conflicts = append(report.Conflicts, s.ID)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	return report, tx.Commit()
+}
+
+func sameSnippet(a, b Snippet) bool {
+	return a.Title == b.Title && a.Content == b.Content && a.Language == b.Language && a.Created.Equal(b.Created) && a.Expires.Equal(b.Expires) &&
+		publishTime(a).Equal(publishTime(b)) && maps.Equal(a.Metadata, b.Metadata)
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// Tables created by schema.sql, in order.
+var schemaTables = func() []string {
+	var tables []string
+	for _, m := range regexp.MustCompile(`(?m)^CREATE TABLE (\w+)`).FindAllStringSubmatch(schemaSQL, -1) {
+		tables = append(tables, m[1])
+	}
+	return tables
+}()
+
+// MissingTables returns the tables from schema.sql that the database
+// doesn't have.
+func (s *MySQLStorage) MissingTables() ([]string, error) {
+	rows, err := s.snippets.DB.Query(`SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing[strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, table := range schemaTables {
+		if !existing[table] {
+			missing = append(missing, table)
+		}
+	}
+	return missing, nil
+}
+
+// InitSchema creates the tables and indexes from schema.sql in an empty
+// database, and reports whether it did. A database that already has every
+// table is left alone. One with only some of them is an error, since it
+// was set up by hand or by an older version and needs Migrate instead.
+func (s *MySQLStorage) InitSchema() (bool, error) {
+	missing, err := s.MissingTables()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case len(missing) == 0:
+		return false, nil
+	case !slices.Equal(missing, schemaTables):
+		return false, fmt.Errorf("models: database has some tables but not %s; migrate it instead", strings.Join(missing, ", "))
+	}
+
+	// MySQL can't run DDL in a transaction, so a failure part way leaves
+	// the tables created so far in place.
+	for _, stmt := range schemaStatements() {
+		if _, err := s.snippets.DB.Exec(stmt); err != nil {
+			return false, fmt.Errorf("models: creating schema: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// Split schema.sql into statements. Comments are dropped first, so a
+// semicolon in one doesn't split a statement and a piece holding only a
+// comment isn't sent, which MySQL would reject as an empty query.
+func schemaStatements() []string {
+	var b strings.Builder
+	for _, line := range strings.Split(schemaSQL, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(b.String(), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
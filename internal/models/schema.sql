@@ -0,0 +1,98 @@
+CREATE TABLE snippets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    title VARCHAR(100) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    -- Counted from content when it's written; see countWords.
+    words INTEGER NOT NULL DEFAULT 0,
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    publish_at DATETIME NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated DATETIME NOT NULL,
+    metadata JSON NULL,
+    -- When syncing clients last saw a change: the later of an update and
+    -- publishing. Kept by MySQL on every write.
+    changed_at DATETIME AS (GREATEST(updated, publish_at)) STORED
+);
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_publish_at ON snippets(publish_at);
+CREATE INDEX idx_snippets_title ON snippets(title);
+CREATE INDEX idx_snippets_updated ON snippets(updated);
+CREATE INDEX idx_snippets_expires ON snippets(expires);
+CREATE INDEX idx_snippets_changed_at ON snippets(changed_at, id);
+
+-- Snippets deleted by the purge, with the time they expired, so syncing
+-- clients that missed the expiry still hear they have gone.
+CREATE TABLE snippet_tombstones (
+    snippet_id INTEGER NOT NULL PRIMARY KEY,
+    expires DATETIME NOT NULL
+);
+
+CREATE INDEX idx_snippet_tombstones_expires ON snippet_tombstones(expires);
+
+-- Share links are signed with their snippet's generation, which revoking
+-- them bumps. Snippets whose links were never revoked have no row.
+CREATE TABLE share_generations (
+    snippet_id INTEGER NOT NULL PRIMARY KEY,
+    generation INTEGER NOT NULL
+);
+
+CREATE TABLE banners (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    message VARCHAR(500) NOT NULL,
+    level ENUM('info', 'warning') NOT NULL DEFAULT 'info',
+    starts DATETIME NOT NULL,
+    ends DATETIME NOT NULL
+);
+
+CREATE INDEX idx_banners_ends ON banners(ends);
+
+-- Views per day, path and visitor. visitor is a hash of the client IP and
+-- user agent with a salt that changes daily and is never stored.
+CREATE TABLE page_views (
+    day DATE NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    visitor CHAR(32) NOT NULL,
+    views INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (day, path, visitor)
+);
+
+-- Activity log shown to admins. title is copied from the snippet so
+-- entries stay readable after it expires.
+CREATE TABLE events (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    kind VARCHAR(20) NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+-- Background job queue. run_at is when a job is next due, or the end of
+-- the lease while a worker holds it. Jobs are deleted when they succeed,
+-- and dead ones, which failed too often, are kept for inspection.
+CREATE TABLE jobs (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    kind VARCHAR(50) NOT NULL,
+    payload BLOB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    run_at DATETIME NOT NULL,
+    last_error VARCHAR(1000) NOT NULL DEFAULT '',
+    dead BOOLEAN NOT NULL DEFAULT FALSE,
+    created DATETIME NOT NULL,
+    -- The kind, for a job that recurs, so there's only ever one of each.
+    recurring_kind VARCHAR(50) NULL UNIQUE
+);
+
+CREATE INDEX idx_jobs_due ON jobs(dead, run_at);
+
+-- Boilerplates a new snippet can start from, managed by the admin.
+CREATE TABLE snippet_templates (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    title VARCHAR(100) NOT NULL DEFAULT '',
+    content MEDIUMTEXT NOT NULL,
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    updated DATETIME NOT NULL
+);
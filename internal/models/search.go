@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidQuery = errors.New("models: invalid search query")
+
+// SnippetFilter narrows a snippet search. Zero-value fields are ignored.
+type SnippetFilter struct {
+	Terms   []string
+	Phrases []string
+	Before  time.Time
+	After   time.Time
+	// Metadata keys the snippet must have, whatever their values.
+	MetaKeys []string
+	// Language the snippet must be marked as, in lower case.
+	Language string
+}
+
+// Parse a search query such as `before:2024-01-01 after:2023-06-01 meta:ci_job lang:go "exact phrase" words`
+// into a SnippetFilter. Unrecognised operators are treated as plain terms.
+func ParseQuery(q string) (SnippetFilter, error) {
+	var f SnippetFilter
+
+	for _, tok := range tokenize(q) {
+		if tok.quoted {
+			f.Phrases = append(f.Phrases, tok.text)
+			continue
+		}
+
+		key, value, found := strings.Cut(tok.text, ":")
+		if !found || value == "" {
+			f.Terms = append(f.Terms, tok.text)
+			continue
+		}
+
+		switch key = strings.ToLower(key); key {
+		case "before", "after":
+			t, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return SnippetFilter{}, fmt.Errorf("%w: %s must be a YYYY-MM-DD date", ErrInvalidQuery, key)
+			}
+			if key == "before" {
+				f.Before = t
+			} else {
+				f.After = t
+			}
+		case "meta":
+			if !ValidMetadataKey(value) {
+				return SnippetFilter{}, fmt.Errorf("%w: meta must be a metadata key", ErrInvalidQuery)
+			}
+			f.MetaKeys = append(f.MetaKeys, value)
+		case "lang":
+			f.Language = strings.ToLower(value)
+		default:
+			f.Terms = append(f.Terms, tok.text)
+		}
+	}
+
+	return f, nil
+}
+
+// Empty reports whether the filter has nothing to search on.
+func (f SnippetFilter) Empty() bool {
+	return len(f.Terms) == 0 && len(f.Phrases) == 0 && f.Before.IsZero() && f.After.IsZero() && len(f.MetaKeys) == 0 && f.Language == ""
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// Split on whitespace, keeping double-quoted runs together. An unterminated
+// quote runs to the end of the input.
+func tokenize(q string) []token {
+	var (
+		tokens []token
+		buf    strings.Builder
+		quoted bool
+	)
+
+	flush := func(wasQuoted bool) {
+		if buf.Len() > 0 {
+			tokens = append(tokens, token{text: buf.String(), quoted: wasQuoted})
+			buf.Reset()
+		}
+	}
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			flush(quoted)
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			flush(false)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	flush(quoted)
+
+	return tokens
+}
+
+// Escapes LIKE wildcards so user input is matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Return a LIKE pattern matching s anywhere.
+func likePattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// Return up to 50 unexpired snippets matching the filter, newest first,
+// without their content.
+func (m *SnippetModel) Search(f SnippetFilter) ([]Snippet, error) {
+	return m.List(SnippetListOptions{Filter: f, Limit: 50})
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"snippety/internal/breaker"
+	"strconv"
+	"sync"
+)
+
+// ShareModelInterface keeps each snippet's share generation, which share
+// links are signed with. Revoking a snippet's links bumps it, so every
+// link made before stops working while other snippets' links carry on.
+type ShareModelInterface interface {
+	// Return the snippet's generation, 0 until its links are first
+	// revoked.
+	Generation(snippetID int) (int, error)
+	// Revoke the snippet's links and return the new generation.
+	Revoke(snippetID int) (int, error)
+}
+
+type ShareModel struct {
+	DB *sql.DB
+	// Shared with the snippet model; see guard.
+	Breaker *breaker.Breaker
+	Logger  *slog.Logger
+}
+
+// Read from the primary, so a revocation takes effect at once.
+func (m *ShareModel) Generation(snippetID int) (int, error) {
+	var n int
+	err := guard(m.Breaker, m.Logger, func() error {
+		return m.DB.QueryRow(`SELECT generation FROM share_generations WHERE snippet_id = ?`, snippetID).Scan(&n)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (m *ShareModel) Revoke(snippetID int) (int, error) {
+	stmt := `INSERT INTO share_generations (snippet_id, generation) VALUES (?, 1)
+    ON DUPLICATE KEY UPDATE generation = generation + 1`
+
+	var n int
+	err := guard(m.Breaker, m.Logger, func() error {
+		if _, err := m.DB.Exec(stmt, snippetID); err != nil {
+			return err
+		}
+		return m.DB.QueryRow(`SELECT generation FROM share_generations WHERE snippet_id = ?`, snippetID).Scan(&n)
+	})
+	return n, err
+}
+
+type MemoryShareModel struct {
+	mu          sync.RWMutex
+	generations map[int]int
+}
+
+func NewMemoryShareModel() *MemoryShareModel {
+	return &MemoryShareModel{generations: map[int]int{}}
+}
+
+func (m *MemoryShareModel) Generation(snippetID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generations[snippetID], nil
+}
+
+func (m *MemoryShareModel) Revoke(snippetID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generations[snippetID]++
+	return m.generations[snippetID], nil
+}
+
+// FileShareModel keeps generations in memory and rewrites a single JSON
+// file, mapping snippet ids to generations, on every revocation.
+type FileShareModel struct {
+	*MemoryShareModel
+
+	path string
+}
+
+func OpenFileShareModel(path string) (*FileShareModel, error) {
+	m := &FileShareModel{MemoryShareModel: NewMemoryShareModel(), path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var generations map[string]int
+	if err := json.Unmarshal(b, &generations); err != nil {
+		return nil, err
+	}
+	for k, n := range generations {
+		id, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, err
+		}
+		m.generations[id] = n
+	}
+
+	return m, nil
+}
+
+// A revocation that can't be saved is undone, so links don't come back to
+// life on restart after it seemed to work.
+func (m *FileShareModel) Revoke(snippetID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generations[snippetID]++
+	generations := make(map[string]int, len(m.generations))
+	for id, n := range m.generations {
+		generations[strconv.Itoa(id)] = n
+	}
+
+	b, err := json.MarshalIndent(generations, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(m.path, b)
+	}
+	if err != nil {
+		m.generations[snippetID]--
+		return 0, err
+	}
+	return m.generations[snippetID], nil
+}
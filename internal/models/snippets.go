@@ -3,30 +3,248 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"io"
+	"log/slog"
+	"snippety/internal/breaker"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type Snippet struct {
 	ID      int
 	Title   string
 	Content string
-	Created time.Time
-	Expires time.Time
+	// Language the content is written in, such as "go" or "json". Empty
+	// means plain text.
+	Language string
+	Created  time.Time
+	Expires  time.Time
+	// Until PublishAt the snippet is left out of listings and only admins
+	// can view it. Snippets published on creation have it equal to Created.
+	PublishAt time.Time
+	// Starts at 1 and goes up by one on every update. Writers pass the
+	// version they loaded so a change made in between isn't overwritten.
+	Version int
+	// Last time the snippet was created, updated or restored.
+	Updated time.Time
+	// Set by API clients; nil when there is none.
+	Metadata Metadata
+
+	// Derived from Content and set on every row. Listings (List and
+	// Search) only load these and leave Content empty.
+	Excerpt string
+	Lines   int
+	Words   int
+	Bytes   int
+}
+
+// Published reports whether the snippet's publish time has passed. A zero
+// PublishAt, as in archives made before scheduling existed, counts as
+// published.
+func (s Snippet) Published() bool {
+	return !s.PublishAt.After(time.Now())
+}
+
+// Column sizes from schema.sql. MySQL rejects longer values with
+// ErrTooLong, and the other backends enforce the same limits. Databases
+// created before content became MEDIUMTEXT hold at most 65535 bytes of
+// content until they're migrated; see ContentColumnBytes.
+const (
+	MaxTitleChars   = 100
+	MaxContentBytes = 1<<24 - 1
+)
+
+// Expired reports whether the snippet's expiry time has passed.
+func (s Snippet) Expired() bool {
+	return !s.Expires.After(time.Now())
+}
+
+// ExpiresIn returns the time left until the snippet expires, or zero if
+// it already has.
+func (s Snippet) ExpiresIn() time.Duration {
+	return max(0, time.Until(s.Expires))
+}
+
+// What Get returns alongside ErrExpired: enough to say when the snippet
+// expired, to check who may see it and to revive it, but none of its
+// contents.
+func (s Snippet) expiredStub() Snippet {
+	return Snippet{ID: s.ID, Expires: s.Expires, PublishAt: s.PublishAt, Version: s.Version}
+}
+
+// Columns selected by listing queries, scanned by scanSummary. The excerpt
+// fetches one character more than it keeps so Truncate knows whether to
+// add an ellipsis.
+const (
+	linesSQL       = `CASE WHEN content = '' THEN 0 ELSE LENGTH(TRIM(TRAILING '\n' FROM content)) - LENGTH(REPLACE(TRIM(TRAILING '\n' FROM content), '\n', '')) + 1 END`
+	summaryColumns = `id, title, LEFT(content, 201), LENGTH(content), ` + linesSQL + `, words, language, created, expires, publish_at, version, updated, metadata`
+)
+
+func scanSummary(rows *sql.Rows) (Snippet, error) {
+	var s Snippet
+	err := rows.Scan(&s.ID, &s.Title, &s.Excerpt, &s.Bytes, &s.Lines, &s.Words, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata)
+	s.Excerpt = Truncate(s.Excerpt, ExcerptLength)
+	return s, err
+}
+
+// SnippetModelInterface is implemented by every snippet storage backend.
+type SnippetModelInterface interface {
+	Insert(title string, content string, language string, metadata Metadata, expires int, policy ExpiryPolicy, publishAt time.Time) (int, error)
+	Get(id int) (Snippet, error)
+	GetLatest(id int) (Snippet, error)
+	OpenContent(id int) (Snippet, io.ReadCloser, error)
+	GetArchived(id int) (Snippet, error)
+	PurgeExpired(before time.Time) ([]int, error)
+	SetExpires(id int, days int, policy ExpiryPolicy, version int) error
+	Update(id int, u SnippetUpdate, policy ExpiryPolicy, version int) error
+	List(opts SnippetListOptions) ([]Snippet, error)
+	Count(opts SnippetListOptions) (int, error)
+	Search(f SnippetFilter) ([]Snippet, error)
+	SuggestTitles(prefix string, limit int) ([]Suggestion, error)
+	Changes(opts ChangesOptions) (SnippetChanges, error)
+	Page(after, limit int) ([]Snippet, error)
+	GetMany(ids []int) ([]Snippet, error)
+	Export() ([]Snippet, error)
+	Restore(snippets []Snippet, overwrite, dryRun bool) (RestoreReport, error)
+	BulkInsert(snippets []Snippet) error
+	Stats(days, topLanguages int) (SnippetStats, error)
+	CreatedPerDay(days int) ([]DayCount, error)
 }
 
 type SnippetModel struct {
 	DB *sql.DB
+	// Optional read-only replica used for reads. Queries fall back to DB
+	// when it is nil or a query against it fails.
+	ReadDB *sql.DB
+	// Queries slower than SlowQuery are logged at WARN. Zero disables it.
+	Logger    *slog.Logger
+	SlowQuery time.Duration
+	// Optional circuit breaker around the primary. While it is open, calls
+	// fail fast with ErrUnavailable instead of waiting on a dead database.
+	Breaker *breaker.Breaker
+
+	// Last successful result for each cacheable listing, served while the
+	// breaker is open.
+	mu    sync.Mutex
+	cache map[listCacheKey][]Snippet
+}
+
+// Run fn against the primary through the circuit breaker.
+func (m *SnippetModel) guard(fn func() error) error {
+	return guard(m.Breaker, m.Logger, fn)
+}
+
+// Run fn through b, which may be nil, failing fast with ErrUnavailable
+// while it's open. Every model on the primary shares one breaker, so an
+// outage seen by any of them stops them all. Only errors that suggest the
+// server is unreachable count as failures; a MySQL error or a missing row
+// means the database answered.
+func guard(b *breaker.Breaker, logger *slog.Logger, fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if !b.Allow() {
+		return ErrUnavailable
+	}
+
+	err := fn()
+
+	var mysqlErr *mysql.MySQLError
+	if err == nil || errors.Is(err, sql.ErrNoRows) || errors.As(err, &mysqlErr) {
+		b.Success()
+		return err
+	}
+
+	if b.Failure() && logger != nil {
+		logger.Error("database circuit breaker opened", slog.String("error", err.Error()), slog.Duration("cooldown", b.Cooldown))
+	}
+	return err
+}
+
+// Time the named query and log it if it was slow. Use as:
+//
+//	defer m.timed("get")()
+func (m *SnippetModel) timed(name string) func() {
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		if m.Logger != nil && m.SlowQuery > 0 && d > m.SlowQuery {
+			m.Logger.Warn("slow query", slog.String("query", "snippets."+name), slog.Duration("duration", d))
+		}
+	}
+}
+
+// Run a read query against the replica, falling back to the primary.
+func (m *SnippetModel) query(stmt string, args ...any) (*sql.Rows, error) {
+	if m.ReadDB != nil {
+		rows, err := m.ReadDB.Query(stmt, args...)
+		if err == nil {
+			return rows, nil
+		}
+	}
+
+	var rows *sql.Rows
+	err := m.guard(func() (err error) {
+		rows, err = m.DB.Query(stmt, args...)
+		return err
+	})
+	return rows, err
+}
+
+// Read a single row from the replica, falling back to the primary. A
+// missing row is retried too, since the replica may lag behind a write
+// made a moment ago.
+func (m *SnippetModel) queryRow(stmt string, args []any, dest ...any) error {
+	if m.ReadDB != nil {
+		err := m.ReadDB.QueryRow(stmt, args...).Scan(dest...)
+		if err == nil {
+			return nil
+		}
+	}
+	return m.queryRowPrimary(stmt, args, dest...)
 }
 
-// Insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-    VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// Read a single row from the primary.
+func (m *SnippetModel) queryRowPrimary(stmt string, args []any, dest ...any) error {
+	return m.guard(func() error {
+		return m.DB.QueryRow(stmt, args...).Scan(dest...)
+	})
+}
+
+// Insert a new snippet into the database, to expire the given number of
+// days from now or never, as the policy allows. A zero publishAt
+// publishes it immediately.
+func (m *SnippetModel) Insert(title string, content string, language string, metadata Metadata, expires int, policy ExpiryPolicy, publishAt time.Time) (int, error) {
+	defer m.timed("insert")()
+
+	if err := policy.Check(expires); err != nil {
+		return 0, err
+	}
+	if err := metadata.check(); err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO snippets (title, content, words, language, metadata, created, expires, publish_at, updated)
+    VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP(), ` + expiresSQL + `, COALESCE(?, UTC_TIMESTAMP()), UTC_TIMESTAMP())`
+
+	var publish any
+	if !publishAt.IsZero() {
+		publish = publishAt.UTC()
+	}
 
 	// Execute insert statement
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	var result sql.Result
+	err := m.guard(func() (err error) {
+		args := append([]any{title, content, countWords(content), language, metadata}, expiresArgs(expires)...)
+		result, err = m.DB.Exec(stmt, append(args, publish)...)
+		return err
+	})
 	if err != nil {
-		return 0, nil
+		return 0, dbError(err)
 	}
 
 	// Get the ID of our newly inserted record
@@ -38,14 +256,128 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 	return int(id), nil
 }
 
-// Return a specific snippet based on its id.
+// SnippetUpdate lists the fields to change in an Update. Nil fields keep
+// their current value.
+type SnippetUpdate struct {
+	Title    *string
+	Content  *string
+	Language *string
+	// Days from now the snippet should expire, or NeverExpires, as the
+	// policy given to Update allows.
+	Expires *int
+	// Replaces all of the snippet's metadata; an empty map removes it.
+	Metadata *Metadata
+}
+
+func (u SnippetUpdate) check(policy ExpiryPolicy) error {
+	if u.Expires != nil {
+		if err := policy.Check(*u.Expires); err != nil {
+			return err
+		}
+	}
+	if (u.Title != nil && utf8.RuneCountInString(*u.Title) > MaxTitleChars) || (u.Content != nil && len(*u.Content) > MaxContentBytes) {
+		return ErrTooLong
+	}
+	if u.Metadata != nil {
+		return u.Metadata.check()
+	}
+	return nil
+}
+
+// Set a snippet to expire the given number of days from now, which can
+// extend or shorten its life or revive an expired one. days must be
+// allowed by the policy.
+func (m *SnippetModel) SetExpires(id int, days int, policy ExpiryPolicy, version int) error {
+	return m.Update(id, SnippetUpdate{Expires: &days}, policy, version)
+}
+
+// Change the given fields of an unexpired snippet. version is the one the
+// caller loaded; if the snippet has been updated since, nothing changes
+// and ErrEditConflict is returned. An expired snippet can only be updated
+// by setting Expires, which brings it back.
+func (m *SnippetModel) Update(id int, u SnippetUpdate, policy ExpiryPolicy, version int) error {
+	defer m.timed("update")()
+
+	if err := u.check(policy); err != nil {
+		return err
+	}
+
+	var (
+		set  []string
+		args []any
+	)
+	if u.Title != nil {
+		set, args = append(set, "title = ?"), append(args, *u.Title)
+	}
+	if u.Content != nil {
+		set, args = append(set, "content = ?", "words = ?"), append(args, *u.Content, countWords(*u.Content))
+	}
+	if u.Language != nil {
+		set, args = append(set, "language = ?"), append(args, *u.Language)
+	}
+	if u.Expires != nil {
+		set, args = append(set, "expires = "+expiresSQL), append(args, expiresArgs(*u.Expires)...)
+	}
+	if u.Metadata != nil {
+		set, args = append(set, "metadata = ?"), append(args, *u.Metadata)
+	}
+	set = append(set, "version = version + 1", "updated = UTC_TIMESTAMP()")
+	args = append(args, u.Expires != nil, id, version)
+
+	stmt := `UPDATE snippets SET ` + strings.Join(set, ", ") + `
+    WHERE (expires > UTC_TIMESTAMP() OR ?) AND id = ? AND version = ?`
+
+	var result sql.Result
+	err := m.guard(func() (err error) {
+		result, err = m.DB.Exec(stmt, args...)
+		return err
+	})
+	if err != nil {
+		return dbError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// The version always changes, so no row means the snippet is
+		// missing or someone else got there first.
+		if _, err := m.GetLatest(id); err != nil && !(errors.Is(err, ErrExpired) && u.Expires != nil) {
+			return err
+		}
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Return a specific snippet based on its id. If it has expired, the error
+// is ErrExpired and the snippet has only its ID, Expires, PublishAt and
+// Version set.
 func (m *SnippetModel) Get(id int) (Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	defer m.timed("get")()
+	return m.get(id, m.queryRow)
+}
 
-	var s Snippet
+// GetLatest is Get reading from the primary, for reading back a write
+// just made and for checking versions before and after a conflict, where
+// a lagging replica's answer would be wrong rather than just old.
+func (m *SnippetModel) GetLatest(id int) (Snippet, error) {
+	defer m.timed("get_latest")()
+	return m.get(id, m.queryRowPrimary)
+}
+
+func (m *SnippetModel) get(id int, queryRow func(stmt string, args []any, dest ...any) error) (Snippet, error) {
+	stmt := `SELECT id, title, content, language, created, expires, publish_at, version, updated, metadata, expires > UTC_TIMESTAMP() FROM snippets
+    WHERE id = ?`
 
-	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	var (
+		s    Snippet
+		live bool
+	)
+
+	err := queryRow(stmt, []any{id}, &s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata, &live)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Snippet{}, ErrNoRecord
@@ -53,14 +385,97 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 			return Snippet{}, err
 		}
 	}
+	if !live {
+		return s.expiredStub(), ErrExpired
+	}
+	s.fillDerived()
 
 	return s, nil
 }
 
-// Return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+// Return up to limit unexpired snippets with ids above after, oldest
+// first. Pass the last id of one page as after to read the next.
+func (m *SnippetModel) Page(after, limit int) ([]Snippet, error) {
+	defer m.timed("page")()
+
+	stmt := `SELECT id, title, content, language, created, expires, publish_at, version, updated, metadata FROM snippets
+    WHERE id > ? AND expires > UTC_TIMESTAMP() ORDER BY id LIMIT ?`
+
+	rows, err := m.query(stmt, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		s.fillDerived()
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Return the unexpired snippets with the given ids, in the same order.
+// Missing or expired ids are skipped.
+func (m *SnippetModel) GetMany(ids []int) ([]Snippet, error) {
+	defer m.timed("get_many")()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	stmt := `SELECT id, title, content, language, created, expires, publish_at, version, updated, metadata FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+
+	rows, err := m.query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]Snippet, len(ids))
+
+	for rows.Next() {
+		var s Snippet
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		s.fillDerived()
+		byID[s.ID] = s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	snippets := make([]Snippet, 0, len(byID))
+	for _, id := range ids {
+		if s, ok := byID[id]; ok {
+			snippets = append(snippets, s)
+		}
+	}
+
+	return snippets, nil
+}
+
+// Return every snippet, including expired ones, oldest first.
+func (m *SnippetModel) Export() ([]Snippet, error) {
+	stmt := `SELECT id, title, content, language, created, expires, publish_at, version, updated, metadata FROM snippets ORDER BY id`
 
 	rows, err := m.DB.Query(stmt)
 	if err != nil {
@@ -72,10 +487,11 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 
 	for rows.Next() {
 		var s Snippet
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata)
 		if err != nil {
 			return nil, err
 		}
+		s.fillDerived()
 		snippets = append(snippets, s)
 	}
 	if err = rows.Err(); err != nil {
@@ -84,3 +500,37 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 
 	return snippets, nil
 }
+
+// Insert many snippets with explicit timestamps in a single transaction.
+// IDs on the given snippets are ignored.
+func (m *SnippetModel) BulkInsert(snippets []Snippet) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO snippets (title, content, words, language, created, expires, publish_at, updated) VALUES (?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, s := range snippets {
+		_, err = stmt.Exec(s.Title, s.Content, countWords(s.Content), s.Language, s.Created, s.Expires, publishTime(s))
+		if err != nil {
+			return dbError(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// The publish_at value to store: snippets without one were published when
+// they were created.
+func publishTime(s Snippet) time.Time {
+	if s.PublishAt.IsZero() {
+		return s.Created
+	}
+	return s.PublishAt
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Number of characters kept in Snippet.Excerpt.
+const ExcerptLength = 200
+
+// Set the fields derived from Content.
+func (s *Snippet) fillDerived() {
+	s.Excerpt = Truncate(s.Content, ExcerptLength)
+	s.Bytes = len(s.Content)
+	s.Lines = countLines(s.Content)
+	s.Words = countWords(s.Content)
+}
+
+// Summary returns a copy suitable for listings: derived fields set and the
+// content dropped.
+func (s Snippet) Summary() Snippet {
+	s.fillDerived()
+	s.Content = ""
+	return s
+}
+
+// Trailing newlines don't start new lines. This matches linesSQL.
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimRight(content, "\n"), "\n") + 1
+}
+
+// Whitespace-separated words. SQL can't count them, so the MySQL backend
+// stores the count in snippets.words whenever it writes content.
+func countWords(content string) int {
+	return len(strings.Fields(content))
+}
+
+// Truncate s to at most n characters, appending an ellipsis when anything
+// was cut. It never splits a multi-byte character.
+func Truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos] + "…"
+		}
+		i++
+	}
+	return s
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+)
+
+// Storage is implemented by each storage backend and hands out the models
+// it provides. Handlers and commands only ever see these interfaces, so
+// backends can be swapped without touching them.
+type Storage interface {
+	Snippets() SnippetModelInterface
+	Banners() BannerModelInterface
+	Templates() TemplateModelInterface
+	PageViews() PageViewModelInterface
+	Events() EventModelInterface
+	Jobs() JobModelInterface
+	Shares() ShareModelInterface
+	Close() error
+}
+
+// MySQLStorage serves every model from a MySQL primary and optional replica.
+type MySQLStorage struct {
+	snippets  *SnippetModel
+	banners   *BannerModel
+	templates *TemplateModel
+	pageViews *PageViewModel
+	events    *EventModel
+	jobs      *JobModel
+	shares    *ShareModel
+}
+
+// The snippet model's DB (and ReadDB, if set) are owned by the storage and
+// closed with it. The other models share its breaker.
+func NewMySQLStorage(snippets *SnippetModel) *MySQLStorage {
+	return &MySQLStorage{
+		snippets:  snippets,
+		banners:   &BannerModel{DB: snippets.DB, Breaker: snippets.Breaker, Logger: snippets.Logger},
+		templates: &TemplateModel{DB: snippets.DB},
+		pageViews: &PageViewModel{DB: snippets.DB, Breaker: snippets.Breaker, Logger: snippets.Logger},
+		events:    &EventModel{DB: snippets.DB},
+		jobs:      &JobModel{DB: snippets.DB, Breaker: snippets.Breaker, Logger: snippets.Logger},
+		shares:    &ShareModel{DB: snippets.DB, Breaker: snippets.Breaker, Logger: snippets.Logger},
+	}
+}
+
+func (s *MySQLStorage) Snippets() SnippetModelInterface {
+	return s.snippets
+}
+
+func (s *MySQLStorage) Banners() BannerModelInterface {
+	return s.banners
+}
+
+func (s *MySQLStorage) Templates() TemplateModelInterface {
+	return s.templates
+}
+
+func (s *MySQLStorage) PageViews() PageViewModelInterface {
+	return s.pageViews
+}
+
+func (s *MySQLStorage) Events() EventModelInterface {
+	return s.events
+}
+
+func (s *MySQLStorage) Jobs() JobModelInterface {
+	return s.jobs
+}
+
+func (s *MySQLStorage) Shares() ShareModelInterface {
+	return s.shares
+}
+
+// Pools returns the connection pools by role, for monitoring.
+func (s *MySQLStorage) Pools() map[string]*sql.DB {
+	pools := map[string]*sql.DB{"primary": s.snippets.DB}
+	if s.snippets.ReadDB != nil {
+		pools["replica"] = s.snippets.ReadDB
+	}
+	return pools
+}
+
+func (s *MySQLStorage) Close() error {
+	var errs []error
+	for _, db := range s.Pools() {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// MemoryStorage keeps everything in process memory.
+type MemoryStorage struct {
+	snippets  *MemorySnippetModel
+	banners   *MemoryBannerModel
+	templates *MemoryTemplateModel
+	pageViews *MemoryPageViewModel
+	events    *MemoryEventModel
+	jobs      *MemoryJobModel
+	shares    *MemoryShareModel
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{snippets: NewMemorySnippetModel(), banners: NewMemoryBannerModel(), templates: NewMemoryTemplateModel(), pageViews: NewMemoryPageViewModel(), events: NewMemoryEventModel(), jobs: NewMemoryJobModel(), shares: NewMemoryShareModel()}
+}
+
+func (s *MemoryStorage) Snippets() SnippetModelInterface {
+	return s.snippets
+}
+
+func (s *MemoryStorage) Banners() BannerModelInterface {
+	return s.banners
+}
+
+func (s *MemoryStorage) Templates() TemplateModelInterface {
+	return s.templates
+}
+
+func (s *MemoryStorage) PageViews() PageViewModelInterface {
+	return s.pageViews
+}
+
+func (s *MemoryStorage) Events() EventModelInterface {
+	return s.events
+}
+
+func (s *MemoryStorage) Jobs() JobModelInterface {
+	return s.jobs
+}
+
+func (s *MemoryStorage) Shares() ShareModelInterface {
+	return s.shares
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// FileStorage keeps everything as JSON files under a directory, except
+// page views, activity events and jobs, which are only kept in memory.
+type FileStorage struct {
+	snippets  *FileSnippetModel
+	banners   *FileBannerModel
+	templates *FileTemplateModel
+	pageViews *MemoryPageViewModel
+	events    *MemoryEventModel
+	jobs      *MemoryJobModel
+	shares    *FileShareModel
+}
+
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	snippets, err := OpenFileSnippetModel(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	banners, err := OpenFileBannerModel(filepath.Join(dir, "banners.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := OpenFileTemplateModel(filepath.Join(dir, "templates.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := OpenFileShareModel(filepath.Join(dir, "shares.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStorage{snippets: snippets, banners: banners, templates: templates, pageViews: NewMemoryPageViewModel(), events: NewMemoryEventModel(), jobs: NewMemoryJobModel(), shares: shares}, nil
+}
+
+func (s *FileStorage) Snippets() SnippetModelInterface {
+	return s.snippets
+}
+
+func (s *FileStorage) Banners() BannerModelInterface {
+	return s.banners
+}
+
+func (s *FileStorage) Templates() TemplateModelInterface {
+	return s.templates
+}
+
+func (s *FileStorage) PageViews() PageViewModelInterface {
+	return s.pageViews
+}
+
+func (s *FileStorage) Events() EventModelInterface {
+	return s.events
+}
+
+func (s *FileStorage) Jobs() JobModelInterface {
+	return s.jobs
+}
+
+func (s *FileStorage) Shares() ShareModelInterface {
+	return s.shares
+}
+
+func (s *FileStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"strings"
+)
+
+// Suggestion is a snippet title offered while someone types a search.
+type Suggestion struct {
+	ID    int
+	Title string
+}
+
+// SuggestTitles returns up to limit live, published snippets whose title
+// starts with prefix, ignoring case, newest first. Only whole-title
+// prefixes are matched so the title index can be used; words later in a
+// title are left to search.
+func (m *SnippetModel) SuggestTitles(prefix string, limit int) ([]Suggestion, error) {
+	defer m.timed("suggest_titles")()
+
+	stmt := `SELECT id, title FROM snippets
+    WHERE title LIKE ? AND expires > UTC_TIMESTAMP() AND publish_at <= UTC_TIMESTAMP()
+    ORDER BY id DESC LIMIT ?`
+
+	rows, err := m.query(stmt, likeEscaper.Replace(prefix)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []Suggestion
+
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.ID, &s.Title); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+func (m *MemorySnippetModel) SuggestTitles(prefix string, limit int) ([]Suggestion, error) {
+	prefix = strings.ToLower(prefix)
+
+	var suggestions []Suggestion
+	for _, s := range m.filter(func(s Snippet) bool { return live(s) && s.Published() }) {
+		if strings.HasPrefix(strings.ToLower(s.Title), prefix) {
+			suggestions = append(suggestions, Suggestion{s.ID, s.Title})
+		}
+	}
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Changes per page when ChangesOptions.Limit is zero, and the most a
+// page may hold.
+const (
+	DefaultChangesLimit = 100
+	MaxChangesLimit     = 1000
+)
+
+// ChangesOptions selects a page of the changes made in [Since, Until),
+// for clients that keep their own copy of the listing.
+type ChangesOptions struct {
+	Since time.Time
+	// Zero means the database's current time, which is returned in
+	// SnippetChanges.Until for the following pages and the next sync.
+	// Bounding the window keeps pages stable while writes go on, and a
+	// time from the database can't skip changes if the app's clock is
+	// behind.
+	Until time.Time
+	// Only changes after this one are returned. The zero value starts at
+	// Since.
+	After ChangePosition
+	// Most changes returned, updates and deletions together. Zero means
+	// DefaultChangesLimit; it's capped at MaxChangesLimit.
+	Limit int
+}
+
+// ChangePosition is a change's place in the order changes are returned
+// in: by time, then by snippet id.
+type ChangePosition struct {
+	At time.Time
+	ID int
+}
+
+func (p ChangePosition) compare(q ChangePosition) int {
+	return cmp.Or(p.At.Compare(q.At), cmp.Compare(p.ID, q.ID))
+}
+
+// SnippetChanges is a page of changes.
+type SnippetChanges struct {
+	// Live, published snippets created, updated or published in the
+	// window, oldest change first.
+	Updated []Snippet
+	// Snippets that expired in the window, with only ID and Expires set,
+	// whether or not they've been purged since.
+	Expired []Snippet
+	// End of the window.
+	Until time.Time
+	// Set when there may be more changes after the last one returned.
+	More bool
+	Last ChangePosition
+}
+
+func (o ChangesOptions) normalize() ChangesOptions {
+	o.Since = o.Since.UTC().Truncate(time.Second)
+	o.Until = o.Until.UTC()
+	if o.After.At.Before(o.Since) {
+		o.After = ChangePosition{At: o.Since}
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultChangesLimit
+	}
+	o.Limit = min(o.Limit, MaxChangesLimit)
+	return o
+}
+
+// Take the first limit changes, in order, from updates and deletions,
+// each already sorted and holding at most limit+1.
+func (c *SnippetChanges) merge(updated, expired []Snippet, limit int) {
+	var i, j int
+	for i+j < limit && (i < len(updated) || j < len(expired)) {
+		if j == len(expired) || (i < len(updated) && changePosition(updated[i]).compare(expiryPosition(expired[j])) < 0) {
+			c.Last = changePosition(updated[i])
+			i++
+		} else {
+			c.Last = expiryPosition(expired[j])
+			j++
+		}
+	}
+	c.Updated, c.Expired = updated[:i], expired[:j]
+	c.More = i < len(updated) || j < len(expired)
+}
+
+// Changes returns a page of the snippets changed in the options' window.
+// A snippet is changed when it is written or when its scheduled publish
+// time passes, and goes away when it expires. Purged snippets are
+// remembered in snippet_tombstones so clients that missed their expiry
+// still hear about it.
+//
+// The queries go to the primary, since a lagging replica could hide
+// changes from a client that then never asks for them again.
+func (m *SnippetModel) Changes(opts ChangesOptions) (SnippetChanges, error) {
+	defer m.timed("changes")()
+
+	opts = opts.normalize()
+
+	var (
+		changes          SnippetChanges
+		updated, expired []Snippet
+	)
+	err := m.guard(func() error {
+		if opts.Until.IsZero() {
+			if err := m.DB.QueryRow(`SELECT UTC_TIMESTAMP()`).Scan(&opts.Until); err != nil {
+				return err
+			}
+		}
+
+		stmt := `SELECT id, title, content, language, created, expires, publish_at, version, updated, metadata FROM snippets
+    WHERE expires > ? AND publish_at <= ? AND changed_at < ?
+    AND (changed_at > ? OR (changed_at = ? AND id > ?))
+    ORDER BY changed_at, id LIMIT ?`
+
+		rows, err := m.DB.Query(stmt, opts.Until, opts.Until, opts.Until, opts.After.At, opts.After.At, opts.After.ID, opts.Limit+1)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s Snippet
+			err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.PublishAt, &s.Version, &s.Updated, &s.Metadata)
+			if err != nil {
+				return err
+			}
+			s.fillDerived()
+			updated = append(updated, s)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		// Snippets that expired before they were published were never
+		// sent, so there's nothing to take back.
+		stmt = `SELECT id, expires FROM snippets
+    WHERE expires < ? AND (expires > ? OR (expires = ? AND id > ?)) AND publish_at <= expires
+    UNION ALL
+    SELECT snippet_id, expires FROM snippet_tombstones
+    WHERE expires < ? AND (expires > ? OR (expires = ? AND snippet_id > ?))
+    ORDER BY expires, id LIMIT ?`
+
+		args := []any{opts.Until, opts.After.At, opts.After.At, opts.After.ID}
+		rows, err = m.DB.Query(stmt, append(append(args, args...), opts.Limit+1)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s Snippet
+			if err = rows.Scan(&s.ID, &s.Expires); err != nil {
+				return err
+			}
+			expired = append(expired, s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return SnippetChanges{}, err
+	}
+
+	changes.Until = opts.Until
+	changes.merge(updated, expired, opts.Limit)
+	return changes, nil
+}
+
+func (m *MemorySnippetModel) Changes(opts ChangesOptions) (SnippetChanges, error) {
+	opts = opts.normalize()
+	if opts.Until.IsZero() {
+		opts.Until = time.Now().UTC().Truncate(time.Second)
+	}
+
+	var updated, expired []Snippet
+
+	m.mu.RLock()
+	for _, s := range m.snippets {
+		switch {
+		case s.Expires.After(opts.Until) && !s.PublishAt.After(opts.Until):
+			if changedAt(s).Before(opts.Until) && changePosition(s).compare(opts.After) > 0 {
+				updated = append(updated, s)
+			}
+		case s.Expires.Before(opts.Until) && !s.PublishAt.After(s.Expires):
+			if p := expiryPosition(s); p.compare(opts.After) > 0 {
+				expired = append(expired, Snippet{ID: s.ID, Expires: s.Expires})
+			}
+		}
+	}
+	for id, expires := range m.tombstones {
+		s := Snippet{ID: id, Expires: expires}
+		if s.Expires.Before(opts.Until) && expiryPosition(s).compare(opts.After) > 0 {
+			expired = append(expired, s)
+		}
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(updated, func(a, b Snippet) int {
+		return changePosition(a).compare(changePosition(b))
+	})
+	slices.SortFunc(expired, func(a, b Snippet) int {
+		return expiryPosition(a).compare(expiryPosition(b))
+	})
+
+	changes := SnippetChanges{Until: opts.Until}
+	changes.merge(updated[:min(len(updated), opts.Limit+1)], expired[:min(len(expired), opts.Limit+1)], opts.Limit)
+	return changes, nil
+}
+
+// When a snippet last changed as far as a syncing client can tell. This
+// matches the changed_at column.
+func changedAt(s Snippet) time.Time {
+	if s.PublishAt.After(s.Updated) {
+		return s.PublishAt
+	}
+	return s.Updated
+}
+
+func changePosition(s Snippet) ChangePosition {
+	return ChangePosition{At: changedAt(s), ID: s.ID}
+}
+
+func expiryPosition(s Snippet) ChangePosition {
+	return ChangePosition{At: s.Expires, ID: s.ID}
+}
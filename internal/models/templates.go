@@ -0,0 +1,318 @@
+package models
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SnippetTemplate is a boilerplate a new snippet can start from, such as
+// a bug report skeleton. The admin manages them, standing in for their
+// owner until there are user accounts.
+type SnippetTemplate struct {
+	ID int
+	// Shown in the create page's template picker.
+	Name     string
+	Title    string
+	Content  string
+	Language string
+	Updated  time.Time
+}
+
+// Column size from schema.sql; Title and Content share the snippet limits.
+const MaxTemplateNameChars = 100
+
+func (t SnippetTemplate) check() error {
+	if utf8.RuneCountInString(t.Name) > MaxTemplateNameChars || utf8.RuneCountInString(t.Title) > MaxTitleChars || len(t.Content) > MaxContentBytes {
+		return ErrTooLong
+	}
+	return nil
+}
+
+type TemplateModelInterface interface {
+	Insert(name, title, content, language string) (int, error)
+	Get(id int) (SnippetTemplate, error)
+	Update(id int, name, title, content, language string) error
+	Delete(id int) error
+	// Every template, by name.
+	All() ([]SnippetTemplate, error)
+}
+
+type TemplateModel struct {
+	DB *sql.DB
+}
+
+func (m *TemplateModel) Insert(name, title, content, language string) (int, error) {
+	if err := (SnippetTemplate{Name: name, Title: title, Content: content}).check(); err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO snippet_templates (name, title, content, language, updated) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, name, title, content, language)
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (m *TemplateModel) Get(id int) (SnippetTemplate, error) {
+	stmt := `SELECT id, name, title, content, language, updated FROM snippet_templates WHERE id = ?`
+
+	var t SnippetTemplate
+	err := m.DB.QueryRow(stmt, id).Scan(&t.ID, &t.Name, &t.Title, &t.Content, &t.Language, &t.Updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SnippetTemplate{}, ErrNoRecord
+	}
+	return t, err
+}
+
+// Replace a template's fields. Updating a missing template returns
+// ErrNoRecord.
+func (m *TemplateModel) Update(id int, name, title, content, language string) error {
+	if err := (SnippetTemplate{Name: name, Title: title, Content: content}).check(); err != nil {
+		return err
+	}
+
+	stmt := `UPDATE snippet_templates SET name = ?, title = ?, content = ?, language = ?, updated = UTC_TIMESTAMP() WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, name, title, content, language, id)
+	if err != nil {
+		return dbError(err)
+	}
+
+	// updated always changes, so no row affected means no template.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete a template. Deleting a missing template returns ErrNoRecord.
+func (m *TemplateModel) Delete(id int) error {
+	result, err := m.DB.Exec(`DELETE FROM snippet_templates WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *TemplateModel) All() ([]SnippetTemplate, error) {
+	rows, err := m.DB.Query(`SELECT id, name, title, content, language, updated FROM snippet_templates ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []SnippetTemplate
+
+	for rows.Next() {
+		var t SnippetTemplate
+		err = rows.Scan(&t.ID, &t.Name, &t.Title, &t.Content, &t.Language, &t.Updated)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// MemoryTemplateModel keeps templates in process memory.
+type MemoryTemplateModel struct {
+	mu        sync.RWMutex
+	templates map[int]SnippetTemplate
+	nextID    int
+}
+
+func NewMemoryTemplateModel() *MemoryTemplateModel {
+	return &MemoryTemplateModel{templates: map[int]SnippetTemplate{}, nextID: 1}
+}
+
+func (m *MemoryTemplateModel) Insert(name, title, content, language string) (int, error) {
+	t := SnippetTemplate{Name: name, Title: title, Content: content, Language: language, Updated: time.Now().UTC().Truncate(time.Second)}
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = m.nextID
+	m.nextID++
+	m.templates[t.ID] = t
+	return t.ID, nil
+}
+
+func (m *MemoryTemplateModel) Get(id int) (SnippetTemplate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.templates[id]
+	if !ok {
+		return SnippetTemplate{}, ErrNoRecord
+	}
+	return t, nil
+}
+
+func (m *MemoryTemplateModel) Update(id int, name, title, content, language string) error {
+	t := SnippetTemplate{ID: id, Name: name, Title: title, Content: content, Language: language, Updated: time.Now().UTC().Truncate(time.Second)}
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.templates[id]; !ok {
+		return ErrNoRecord
+	}
+	m.templates[id] = t
+	return nil
+}
+
+func (m *MemoryTemplateModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.templates[id]; !ok {
+		return ErrNoRecord
+	}
+	delete(m.templates, id)
+	return nil
+}
+
+func (m *MemoryTemplateModel) All() ([]SnippetTemplate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	templates := make([]SnippetTemplate, 0, len(m.templates))
+	for _, t := range m.templates {
+		templates = append(templates, t)
+	}
+	slices.SortFunc(templates, func(a, b SnippetTemplate) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	return templates, nil
+}
+
+type fileTemplate struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// FileTemplateModel keeps templates in memory and rewrites a single JSON
+// file on every change.
+type FileTemplateModel struct {
+	*MemoryTemplateModel
+
+	path string
+	mu   sync.Mutex
+}
+
+func OpenFileTemplateModel(path string) (*FileTemplateModel, error) {
+	m := &FileTemplateModel{MemoryTemplateModel: NewMemoryTemplateModel(), path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []fileTemplate
+	if err := json.Unmarshal(b, &templates); err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		m.templates[t.ID] = SnippetTemplate(t)
+		m.nextID = max(m.nextID, t.ID+1)
+	}
+
+	return m, nil
+}
+
+func (m *FileTemplateModel) Insert(name, title, content, language string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, err := m.MemoryTemplateModel.Insert(name, title, content, language)
+	if err != nil {
+		return 0, err
+	}
+	return id, m.save()
+}
+
+func (m *FileTemplateModel) Update(id int, name, title, content, language string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.MemoryTemplateModel.Update(id, name, title, content, language); err != nil {
+		return err
+	}
+	return m.save()
+}
+
+func (m *FileTemplateModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.MemoryTemplateModel.Delete(id); err != nil {
+		return err
+	}
+	return m.save()
+}
+
+func (m *FileTemplateModel) save() error {
+	all, err := m.MemoryTemplateModel.All()
+	if err != nil {
+		return err
+	}
+
+	templates := make([]fileTemplate, len(all))
+	for i, t := range all {
+		templates[i] = fileTemplate(t)
+	}
+
+	b, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, b)
+}
@@ -0,0 +1,252 @@
+// Package pdf renders a titled plain text document as a PDF, using only
+// the standard Courier and Helvetica fonts so nothing has to be embedded.
+// Those fonts only cover WinAnsi, about Latin-1, so documents with other
+// characters are refused rather than drawn with gaps; see Supported.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUnsupportedText is returned, wrapped with the first character at
+// fault, for a document the standard fonts can't show.
+var ErrUnsupportedText = errors.New("pdf: text has characters the standard fonts lack")
+
+// A4 portrait, in points.
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 56
+
+	titleSize  = 14
+	headerSize = 10
+	bodySize   = 9
+	footerSize = 8
+	leading    = 11
+
+	// Courier glyphs are 0.6em wide, so this many fit across the page.
+	lineChars = (pageWidth - 2*margin) * 10 / (bodySize * 6)
+	// Helvetica is narrower on average; titles are wrapped well short of
+	// the edge.
+	titleChars = 60
+	tabWidth   = 4
+)
+
+// Fonts, by their resource names in each page.
+const (
+	courier       = "F1"
+	helvetica     = "F2"
+	helveticaBold = "F3"
+)
+
+// Objects 1-6 are the catalog, page tree, fonts and info. Each page
+// follows as a page object and its content stream.
+const firstPageObject = 7
+
+// Document is the content of a PDF.
+type Document struct {
+	Title string
+	// Lines shown under the title in a proportional font, such as metadata.
+	Header []string
+	// Monospaced text, wrapped to fit the page.
+	Body string
+}
+
+type textOp struct {
+	font string
+	size int
+	x, y int
+	text string
+}
+
+// WriteTo renders the document to w.
+func (d Document) WriteTo(w io.Writer) (int64, error) {
+	for _, s := range append([]string{d.Title, d.Body}, d.Header...) {
+		if r, ok := unsupported(s); ok {
+			return 0, fmt.Errorf("%w: %q", ErrUnsupportedText, r)
+		}
+	}
+
+	pages := d.layout()
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title %s /Producer (Snippetbox) >>", pdfString(d.Title)))
+
+	for i, ops := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Contents %d 0 R "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> >>",
+			pageWidth, pageHeight, firstPageObject+2*i+1, courier, helvetica, helveticaBold))
+
+		var content strings.Builder
+		for _, op := range ops {
+			fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td %s Tj ET\n", op.font, op.size, op.x, op.y, pdfString(op.text))
+		}
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Place the document's text on pages, with a page number at the foot of
+// each.
+func (d Document) layout() [][]textOp {
+	var (
+		pages [][]textOp
+		ops   []textOp
+		y     = pageHeight - margin
+	)
+	add := func(font string, size, lineHeight int, text string) {
+		if y-lineHeight < margin {
+			pages = append(pages, ops)
+			ops, y = nil, pageHeight-margin
+		}
+		y -= lineHeight
+		ops = append(ops, textOp{font, size, margin, y, text})
+	}
+
+	for _, line := range wrap(d.Title, titleChars) {
+		add(helveticaBold, titleSize, titleSize+4, line)
+	}
+	for _, line := range d.Header {
+		add(helvetica, headerSize, headerSize+3, line)
+	}
+	y -= leading
+	for _, line := range wrap(d.Body, lineChars) {
+		add(courier, bodySize, leading, line)
+	}
+	pages = append(pages, ops)
+
+	for i := range pages {
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(pages))
+		pages[i] = append(pages[i], textOp{helvetica, footerSize, margin, margin / 2, footer})
+	}
+	return pages
+}
+
+// Split text into lines of at most width characters, breaking long lines
+// wherever they reach the limit since code has no good break points.
+func wrap(text string, width int) []string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(expandTabs(line))
+		for len(runes) > width {
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+// Supported reports whether every character of the texts can be shown.
+// Tabs and line breaks are fine in a document's body.
+func Supported(texts ...string) bool {
+	for _, s := range texts {
+		if _, ok := unsupported(s); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the first character of s with no WinAnsi code.
+func unsupported(s string) (rune, bool) {
+	for _, r := range s {
+		if r == '\t' || r == '\n' || r == '\r' {
+			continue
+		}
+		if _, ok := winAnsi(r); !ok {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// WinAnsi matches Latin-1 but for 0x80-0x9F, where it has typographic
+// punctuation and a few letters instead of control characters.
+var winAnsiExtra = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+func winAnsi(r rune) (byte, bool) {
+	switch {
+	case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+		return byte(r), true
+	}
+	b, ok := winAnsiExtra[r]
+	return b, ok
+}
+
+// Encode s as a PDF literal string in WinAnsi. Callers have checked it
+// with unsupported, but anything missed is drawn as '?'.
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		c, ok := winAnsi(r)
+		switch {
+		case !ok:
+			b.WriteByte('?')
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
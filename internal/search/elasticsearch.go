@@ -0,0 +1,471 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"snippety/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mapping = `{
+  "mappings": {
+    "properties": {
+      "title":   {"type": "text"},
+      "content": {"type": "text"},
+      "language": {"type": "keyword"},
+      "created": {"type": "date"},
+      "expires": {"type": "date"},
+      "publish_at": {"type": "date"},
+      "metadata": {"type": "object"}
+    }
+  }
+}`
+
+// Elasticsearch indexes snippets in an Elasticsearch or OpenSearch cluster
+// through its REST API.
+//
+// The index name given is an alias for the real index, which is named
+// after it with a timestamp. Rebuild fills a new index and then swaps the
+// alias over, so searches see the old index until the new one is
+// complete.
+type Elasticsearch struct {
+	Snippets models.SnippetModelInterface
+
+	baseURL string
+	index   string
+	client  *http.Client
+
+	mu sync.Mutex
+	// Whether the index is known to exist.
+	ready bool
+	// The index a running Rebuild is filling, which writes go to as well
+	// so it doesn't miss them.
+	building string
+}
+
+type esDocument struct {
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	// Indexes created before scheduling existed lack this field until they
+	// are rebuilt, so a missing value counts as published.
+	PublishAt time.Time       `json:"publish_at"`
+	Metadata  models.Metadata `json:"metadata,omitempty"`
+}
+
+// NewElasticsearch returns a backend for the cluster at baseURL. It
+// doesn't contact the cluster: the index is created with its mapping, if
+// it doesn't exist, on first use or by Prepare.
+func NewElasticsearch(baseURL, index string, snippets models.SnippetModelInterface) *Elasticsearch {
+	return &Elasticsearch{
+		Snippets: snippets,
+		baseURL:  baseURL,
+		index:    index,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Prepare connects to the cluster and creates the index if it doesn't
+// exist yet. Until it succeeds, every call tries again.
+func (e *Elasticsearch) Prepare() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.ready {
+		return nil
+	}
+
+	res, err := e.do(http.MethodHead, e.index, nil)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		res, err = e.do(http.MethodPut, e.newIndexName(), indexBody(e.index))
+		if err != nil {
+			return err
+		}
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+
+	e.ready = true
+	return nil
+}
+
+// Name a new index for the alias.
+func (e *Elasticsearch) newIndexName() string {
+	return e.index + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// The body creating an index with the mapping, and with alias when it's
+// not empty.
+func indexBody(alias string) []byte {
+	var body map[string]any
+	json.Unmarshal([]byte(mapping), &body)
+	if alias != "" {
+		body["aliases"] = map[string]any{alias: map[string]any{}}
+	}
+	b, _ := json.Marshal(body)
+	return b
+}
+
+// Return the indexes a write should go to: the alias and, during a
+// rebuild, the new index.
+func (e *Elasticsearch) writeIndexes() ([]string, error) {
+	if err := e.Prepare(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.building != "" {
+		return []string{e.index, e.building}, nil
+	}
+	return []string{e.index}, nil
+}
+
+func (e *Elasticsearch) Index(s models.Snippet) error {
+	body, err := json.Marshal(toDocument(s))
+	if err != nil {
+		return err
+	}
+
+	indexes, err := e.writeIndexes()
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		res, err := e.do(http.MethodPut, index+"/_doc/"+strconv.Itoa(s.ID), body)
+		if err != nil {
+			return err
+		}
+		if err := checkResponse(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Elasticsearch) Delete(id int) error {
+	indexes, err := e.writeIndexes()
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		res, err := e.do(http.MethodDelete, index+"/_doc/"+strconv.Itoa(id), nil)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode == http.StatusNotFound {
+			res.Body.Close()
+			continue
+		}
+		if err := checkResponse(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rebuild indexes every unexpired snippet into a new index using the bulk
+// API, then points the alias at it and deletes the old one. Writes made
+// meanwhile go to both. If it fails, the new index is dropped and the old
+// one stays in use.
+func (e *Elasticsearch) Rebuild() (err error) {
+	if err := e.Prepare(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	if e.building != "" {
+		e.mu.Unlock()
+		return errors.New("search: a rebuild is already running")
+	}
+	index := e.newIndexName()
+	e.building = index
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		e.building = ""
+		e.mu.Unlock()
+		if err != nil {
+			if res, derr := e.do(http.MethodDelete, index, nil); derr == nil {
+				res.Body.Close()
+			}
+		}
+	}()
+
+	res, err := e.do(http.MethodPut, index, indexBody(""))
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+
+	// Read the snippets after the new index starts taking writes, so none
+	// made in between are missed.
+	for after := 0; ; {
+		snippets, err := e.Snippets.Page(after, rebuildPage)
+		if err != nil {
+			return err
+		}
+		if len(snippets) == 0 {
+			break
+		}
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, s := range snippets {
+			enc.Encode(map[string]any{"index": map[string]any{"_id": strconv.Itoa(s.ID)}})
+			enc.Encode(toDocument(s))
+		}
+
+		res, err := e.do(http.MethodPost, index+"/_bulk", buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		var out struct {
+			Errors bool `json:"errors"`
+		}
+		if err := decodeResponse(res, &out); err != nil {
+			return err
+		}
+		if out.Errors {
+			return fmt.Errorf("search: bulk indexing reported errors")
+		}
+
+		after = snippets[len(snippets)-1].ID
+	}
+
+	res, err = e.do(http.MethodPost, index+"/_refresh", nil)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+
+	return e.swapAlias(index)
+}
+
+// Point the alias at index alone, in one atomic change, and delete the
+// indexes it pointed at before. An index named like the alias, as made by
+// versions before aliases were used, is replaced by it.
+func (e *Elasticsearch) swapAlias(index string) error {
+	old, err := e.aliasIndexes()
+	if err != nil {
+		return err
+	}
+
+	actions := []any{map[string]any{"add": map[string]any{"index": index, "alias": e.index}}}
+	if len(old) == 0 {
+		// Either nothing is there, or a plain index with the alias's name.
+		res, err := e.do(http.MethodHead, e.index, nil)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			actions = append(actions, map[string]any{"remove_index": map[string]any{"index": e.index}})
+		}
+	}
+	for _, name := range old {
+		actions = append(actions, map[string]any{"remove": map[string]any{"index": name, "alias": e.index}})
+	}
+
+	body, err := json.Marshal(map[string]any{"actions": actions})
+	if err != nil {
+		return err
+	}
+	res, err := e.do(http.MethodPost, "_aliases", body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+
+	if len(old) > 0 {
+		res, err = e.do(http.MethodDelete, strings.Join(old, ","), nil)
+		if err != nil {
+			return err
+		}
+		if err := checkResponse(res); err != nil {
+			return fmt.Errorf("search: the alias was swapped but removing the old index failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Return the indexes the alias points at, none if it isn't an alias.
+func (e *Elasticsearch) aliasIndexes() ([]string, error) {
+	res, err := e.do(http.MethodGet, "_alias/"+e.index, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, nil
+	}
+
+	var out map[string]any
+	if err := decodeResponse(res, &out); err != nil {
+		return nil, err
+	}
+	indexes := make([]string, 0, len(out))
+	for name := range out {
+		indexes = append(indexes, name)
+	}
+	return indexes, nil
+}
+
+func (e *Elasticsearch) Search(f models.SnippetFilter) ([]models.Snippet, error) {
+	var (
+		must   []any
+		filter = []any{
+			map[string]any{"range": map[string]any{"expires": map[string]any{"gt": "now"}}},
+			map[string]any{"bool": map[string]any{"should": []any{
+				map[string]any{"range": map[string]any{"publish_at": map[string]any{"lte": "now"}}},
+				map[string]any{"bool": map[string]any{"must_not": map[string]any{"exists": map[string]any{"field": "publish_at"}}}},
+			}}},
+		}
+	)
+
+	for _, t := range f.Terms {
+		must = append(must, map[string]any{"multi_match": map[string]any{
+			"query":     t,
+			"fields":    []string{"title^2", "content"},
+			"fuzziness": "AUTO",
+		}})
+	}
+	for _, p := range f.Phrases {
+		must = append(must, map[string]any{"multi_match": map[string]any{
+			"query":  p,
+			"fields": []string{"title^2", "content"},
+			"type":   "phrase",
+		}})
+	}
+
+	created := map[string]any{}
+	if !f.Before.IsZero() {
+		created["lt"] = f.Before
+	}
+	if !f.After.IsZero() {
+		created["gte"] = f.After
+	}
+	if len(created) > 0 {
+		filter = append(filter, map[string]any{"range": map[string]any{"created": created}})
+	}
+	for _, key := range f.MetaKeys {
+		filter = append(filter, map[string]any{"exists": map[string]any{"field": "metadata." + key}})
+	}
+	if f.Language != "" {
+		filter = append(filter, map[string]any{"term": map[string]any{"language": f.Language}})
+	}
+
+	boolQuery := map[string]any{"filter": filter}
+	if len(must) > 0 {
+		boolQuery["must"] = must
+	}
+
+	query, err := json.Marshal(map[string]any{
+		"size":  maxResults,
+		"query": map[string]any{"bool": boolQuery},
+		"sort":  []any{"_score", map[string]any{"created": "desc"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.Prepare(); err != nil {
+		return nil, err
+	}
+	res, err := e.do(http.MethodPost, e.index+"/_search", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Hits struct {
+			Hits []struct {
+				ID     string     `json:"_id"`
+				Source esDocument `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := decodeResponse(res, &out); err != nil {
+		return nil, err
+	}
+
+	snippets := make([]models.Snippet, 0, len(out.Hits.Hits))
+	for _, hit := range out.Hits.Hits {
+		id, err := strconv.Atoi(hit.ID)
+		if err != nil {
+			return nil, fmt.Errorf("search: unexpected document id %q", hit.ID)
+		}
+		snippets = append(snippets, models.Snippet{
+			ID:        id,
+			Title:     hit.Source.Title,
+			Content:   hit.Source.Content,
+			Language:  hit.Source.Language,
+			Created:   hit.Source.Created,
+			Expires:   hit.Source.Expires,
+			PublishAt: hit.Source.PublishAt,
+			Metadata:  hit.Source.Metadata,
+		}.Summary())
+	}
+
+	return snippets, nil
+}
+
+func toDocument(s models.Snippet) esDocument {
+	return esDocument{Title: s.Title, Content: s.Content, Language: s.Language, Created: s.Created, Expires: s.Expires, PublishAt: s.PublishAt, Metadata: s.Metadata}
+}
+
+func (e *Elasticsearch) do(method, path string, body []byte) (*http.Response, error) {
+	u := strings.TrimSuffix(e.baseURL, "/") + "/" + path
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return e.client.Do(req)
+}
+
+func checkResponse(res *http.Response) error {
+	return decodeResponse(res, nil)
+}
+
+// Close the response body, returning an error for non-2xx statuses and
+// decoding the body into v when it is non-nil.
+func decodeResponse(res *http.Response, v any) error {
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("search: %s %s: %s: %s", res.Request.Method, res.Request.URL.Path, res.Status, msg)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
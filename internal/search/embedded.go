@@ -0,0 +1,493 @@
+package search
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"snippety/internal/models"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum number of results returned by a search.
+const maxResults = 50
+
+// Embedded is an inverted index kept in memory and persisted next to a
+// file. Terms are matched with a small edit-distance allowance so minor
+// typos still find results. Snippet rows are loaded from the model so
+// expiry is always respected.
+//
+// Writes are appended to a log beside the snapshot at path, which is only
+// rewritten once the log has grown to compactAfter entries, so indexing
+// one snippet costs one small append rather than writing the whole index.
+type Embedded struct {
+	Snippets models.SnippetModelInterface
+
+	path string
+	mu   sync.RWMutex
+	data indexData
+	log  *os.File
+	// Entries in the log since the snapshot was written.
+	logged int
+}
+
+// Log entries written before the snapshot is rewritten and the log
+// started afresh.
+const compactAfter = 1000
+
+type indexData struct {
+	// term -> snippet id -> occurrences
+	Postings map[string]map[int]int
+	// snippet id -> indexed terms, used to remove a document
+	Docs    map[int][]string
+	Created map[int]time.Time
+
+	// Each term's deletion variants -> the terms they came from; see
+	// variants. Built from Postings rather than saved.
+	fuzzy map[string][]string
+}
+
+func newIndexData() indexData {
+	return indexData{
+		Postings: map[string]map[int]int{},
+		Docs:     map[int][]string{},
+		Created:  map[int]time.Time{},
+		fuzzy:    map[string][]string{},
+	}
+}
+
+// A write to the index, as recorded in the log.
+type logEntry struct {
+	ID      int            `json:"id"`
+	Created time.Time      `json:"created"`
+	Terms   map[string]int `json:"terms,omitempty"`
+	Deleted bool           `json:"deleted,omitempty"`
+}
+
+func (e *Embedded) logPath() string {
+	return e.path + ".log"
+}
+
+// Open the index stored at path, replaying the writes logged since it was
+// saved. If the file does not exist the index is rebuilt from the
+// database.
+func OpenEmbedded(path string, snippets models.SnippetModelInterface) (*Embedded, error) {
+	e := &Embedded{Snippets: snippets, path: path, data: newIndexData()}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return e, e.Rebuild()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(&e.data); err != nil {
+		return nil, err
+	}
+	e.data.fuzzy = map[string][]string{}
+	for t := range e.data.Postings {
+		e.data.addVariants(t)
+	}
+
+	if err := e.replay(); err != nil {
+		return nil, err
+	}
+	e.log, err = os.OpenFile(e.logPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Apply the logged writes to the loaded snapshot. Applying one twice does
+// no harm, so a crash between saving a snapshot and truncating the log is
+// safe. A final line cut short by a crash is ignored.
+func (e *Embedded) replay() error {
+	f, err := os.Open(e.logPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var entry logEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			break
+		}
+		e.data.apply(entry)
+		e.logged++
+	}
+	return sc.Err()
+}
+
+// Rebuild the whole index from the snippets table.
+func (e *Embedded) Rebuild() error {
+	data := newIndexData()
+	for after := 0; ; {
+		snippets, err := e.Snippets.Page(after, rebuildPage)
+		if err != nil {
+			return err
+		}
+		for _, s := range snippets {
+			data.apply(entryFor(s))
+		}
+		if len(snippets) < rebuildPage {
+			break
+		}
+		after = snippets[len(snippets)-1].ID
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.data = data
+	return e.save()
+}
+
+func (e *Embedded) Index(s models.Snippet) error {
+	return e.write(entryFor(s))
+}
+
+func (e *Embedded) Delete(id int) error {
+	return e.write(logEntry{ID: id, Deleted: true})
+}
+
+// Apply a write and log it, saving a fresh snapshot instead once the log
+// is long enough.
+func (e *Embedded) write(entry logEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.data.apply(entry)
+	if e.log == nil || e.logged+1 >= compactAfter {
+		return e.save()
+	}
+	if _, err := e.log.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	e.logged++
+	return nil
+}
+
+func entryFor(s models.Snippet) logEntry {
+	counts := map[string]int{}
+	for _, t := range terms(s.Title + " " + s.Content) {
+		counts[t]++
+	}
+	return logEntry{ID: s.ID, Created: s.Created, Terms: counts}
+}
+
+func (e *Embedded) Search(f models.SnippetFilter) ([]models.Snippet, error) {
+	var words []string
+	for _, t := range f.Terms {
+		words = append(words, terms(t)...)
+	}
+	for _, p := range f.Phrases {
+		words = append(words, terms(p)...)
+	}
+
+	e.mu.RLock()
+	scores := e.data.score(words)
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		created := e.data.Created[id]
+		if !f.Before.IsZero() && !created.Before(f.Before) {
+			continue
+		}
+		if !f.After.IsZero() && created.Before(f.After) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	e.mu.RUnlock()
+
+	slices.SortFunc(ids, func(a, b int) int {
+		return cmp.Or(cmp.Compare(scores[b], scores[a]), cmp.Compare(b, a))
+	})
+
+	// The index only knows about words, so exact phrases, metadata keys
+	// and the language are checked against the loaded rows. Rows are fetched in batches until enough match.
+	var results []models.Snippet
+	for batch := range slices.Chunk(ids, 2*maxResults) {
+		snippets, err := e.Snippets.GetMany(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range snippets {
+			if s.Published() && containsPhrases(s, f.Phrases) && s.Metadata.HasKeys(f.MetaKeys) &&
+				(f.Language == "" || strings.EqualFold(s.Language, f.Language)) {
+				results = append(results, s.Summary())
+			}
+			if len(results) == maxResults {
+				return results, nil
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func containsPhrases(s models.Snippet, phrases []string) bool {
+	title, content := strings.ToLower(s.Title), strings.ToLower(s.Content)
+	for _, p := range phrases {
+		p = strings.ToLower(p)
+		if !strings.Contains(title, p) && !strings.Contains(content, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Write the index to a temporary file and rename it into place so a crash
+// never leaves a truncated index behind, then start the log afresh.
+// Callers must hold the lock.
+func (e *Embedded) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(e.path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(e.data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), e.path); err != nil {
+		return err
+	}
+
+	if e.log != nil {
+		e.log.Close()
+	}
+	e.log, err = os.Create(e.logPath())
+	if err != nil {
+		return err
+	}
+	e.logged = 0
+	return nil
+}
+
+// Apply a logged write: replace the snippet's terms, or drop it.
+func (d indexData) apply(entry logEntry) {
+	d.remove(entry.ID)
+	if entry.Deleted {
+		return
+	}
+
+	docTerms := make([]string, 0, len(entry.Terms))
+	for t, n := range entry.Terms {
+		if d.Postings[t] == nil {
+			d.Postings[t] = map[int]int{}
+			d.addVariants(t)
+		}
+		d.Postings[t][entry.ID] = n
+		docTerms = append(docTerms, t)
+	}
+
+	d.Docs[entry.ID] = docTerms
+	d.Created[entry.ID] = entry.Created
+}
+
+func (d indexData) remove(id int) {
+	for _, t := range d.Docs[id] {
+		delete(d.Postings[t], id)
+		if len(d.Postings[t]) == 0 {
+			delete(d.Postings, t)
+			d.removeVariants(t)
+		}
+	}
+	delete(d.Docs, id)
+	delete(d.Created, id)
+}
+
+// Terms longer than this are only matched exactly, since the number of
+// deletion variants grows with the square of the length.
+const maxFuzzyTermRunes = 24
+
+func (d indexData) addVariants(t string) {
+	if utf8.RuneCountInString(t) > maxFuzzyTermRunes {
+		return
+	}
+	for _, v := range variants(t, 2) {
+		d.fuzzy[v] = append(d.fuzzy[v], t)
+	}
+}
+
+func (d indexData) removeVariants(t string) {
+	if utf8.RuneCountInString(t) > maxFuzzyTermRunes {
+		return
+	}
+	for _, v := range variants(t, 2) {
+		terms := slices.DeleteFunc(d.fuzzy[v], func(s string) bool { return s == t })
+		if len(terms) == 0 {
+			delete(d.fuzzy, v)
+		} else {
+			d.fuzzy[v] = terms
+		}
+	}
+}
+
+// Return the indexed terms within w's typo allowance. Two words within k
+// edits share a string made by deleting at most k runes from each, so
+// only the terms sharing one of w's deletion variants need comparing.
+func (d indexData) nearTerms(w string) []string {
+	k := allowedTypos(w)
+	if k == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var near []string
+	for _, v := range variants(w, k) {
+		for _, t := range d.fuzzy[v] {
+			if !seen[t] && t != w && withinDistance(t, w, k) {
+				seen[t] = true
+				near = append(near, t)
+			}
+		}
+	}
+	return near
+}
+
+// Return w and every distinct string made by deleting up to k of its
+// runes.
+func variants(w string, k int) []string {
+	seen := map[string]bool{w: true}
+	out := []string{w}
+	level := []string{w}
+	for range k {
+		var next []string
+		for _, s := range level {
+			r := []rune(s)
+			for i := range r {
+				v := string(r[:i]) + string(r[i+1:])
+				if !seen[v] {
+					seen[v] = true
+					out = append(out, v)
+					next = append(next, v)
+				}
+			}
+		}
+		level = next
+	}
+	return out
+}
+
+// Score every document containing all query words (or a near miss of each
+// word). Exact hits count double. With no words, every document matches.
+func (d indexData) score(words []string) map[int]int {
+	scores := map[int]int{}
+
+	if len(words) == 0 {
+		for id := range d.Docs {
+			scores[id] = 0
+		}
+		return scores
+	}
+
+	for i, w := range words {
+		hits := map[int]int{}
+		for id, n := range d.Postings[w] {
+			hits[id] += 2 * n
+		}
+		for _, t := range d.nearTerms(w) {
+			for id, n := range d.Postings[t] {
+				hits[id] += n
+			}
+		}
+
+		if i == 0 {
+			scores = hits
+			continue
+		}
+		for id := range scores {
+			if n, ok := hits[id]; ok {
+				scores[id] += n
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	return scores
+}
+
+func allowedTypos(w string) int {
+	switch n := len([]rune(w)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Split text into lowercase words of letters and digits.
+func terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Report whether the Levenshtein distance between a and b is at most limit.
+func withinDistance(a, b string, limit int) bool {
+	if limit == 0 {
+		return a == b
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return false
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return false
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)] <= limit
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"log/slog"
+	"snippety/internal/models"
+)
+
+// Backend finds snippets matching a filter and is kept in sync with writes.
+type Backend interface {
+	Search(f models.SnippetFilter) ([]models.Snippet, error)
+	Index(s models.Snippet) error
+	Delete(id int) error
+}
+
+// Rebuilder is implemented by backends that keep their own copy of the
+// data and can re-index it from the database.
+type Rebuilder interface {
+	Rebuild() error
+}
+
+// How many snippets a rebuild reads from the database at a time.
+const rebuildPage = 500
+
+// SQL searches through the snippet model directly. Index and Delete are
+// no-ops since the model is always current.
+type SQL struct {
+	Snippets models.SnippetModelInterface
+}
+
+func (b *SQL) Search(f models.SnippetFilter) ([]models.Snippet, error) {
+	return b.Snippets.Search(f)
+}
+
+func (b *SQL) Index(s models.Snippet) error {
+	return nil
+}
+
+func (b *SQL) Delete(id int) error {
+	return nil
+}
+
+// Fallback searches Primary and retries against Secondary when the primary
+// backend fails, so an unavailable search cluster degrades to SQL search.
+type Fallback struct {
+	Primary   Backend
+	Secondary Backend
+	Logger    *slog.Logger
+}
+
+func (b *Fallback) Search(f models.SnippetFilter) ([]models.Snippet, error) {
+	snippets, err := b.Primary.Search(f)
+	if err != nil {
+		b.Logger.Warn("search backend failed, falling back", slog.String("error", err.Error()))
+		return b.Secondary.Search(f)
+	}
+	return snippets, nil
+}
+
+func (b *Fallback) Index(s models.Snippet) error {
+	return b.Primary.Index(s)
+}
+
+func (b *Fallback) Delete(id int) error {
+	return b.Primary.Delete(id)
+}
+
+func (b *Fallback) Rebuild() error {
+	if r, ok := b.Primary.(Rebuilder); ok {
+		return r.Rebuild()
+	}
+	return nil
+}
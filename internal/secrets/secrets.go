@@ -0,0 +1,119 @@
+// Package secrets resolves secret settings given by reference, so the
+// secret itself needn't appear in flags, the process list or shell
+// history. A reference is one of:
+//
+//	file:/run/secrets/dsn         the file's contents, such as a Docker or
+//	                              Kubernetes secret
+//	vault:secret/data/snippety#dsn
+//	                              field dsn of a HashiCorp Vault secret
+//
+// Anything else is taken literally.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Resolver looks up references. The zero value reads files; set VaultAddr
+// and VaultToken to read from Vault.
+type Resolver struct {
+	// Base URL of the Vault server, such as https://vault.example:8200.
+	VaultAddr  string
+	VaultToken string
+	Client     *http.Client
+}
+
+// FromEnv returns a Resolver using Vault's standard VAULT_ADDR and
+// VAULT_TOKEN environment variables.
+func FromEnv() *Resolver {
+	return &Resolver{
+		VaultAddr:  os.Getenv("VAULT_ADDR"),
+		VaultToken: os.Getenv("VAULT_TOKEN"),
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Resolve returns the secret ref refers to, or ref itself if it isn't a
+// reference.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "file:"):
+		return readFile(strings.TrimPrefix(ref, "file:"))
+	case strings.HasPrefix(ref, "vault:"):
+		return r.vault(ctx, strings.TrimPrefix(ref, "vault:"))
+	}
+	return ref, nil
+}
+
+// Read a secret file. Files written with echo or an editor end in a
+// newline, which is never part of the secret.
+func readFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Read one field of a Vault secret. path is the API path after /v1/; for
+// the KV version 2 engine that includes "data/", as in
+// secret/data/snippety. Version 1 secrets work too.
+func (r *Resolver) vault(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("secrets: vault reference %q must be path#field", ref)
+	}
+	if r.VaultAddr == "" || r.VaultToken == "" {
+		return "", errors.New("secrets: vault references need VAULT_ADDR and VAULT_TOKEN")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(r.VaultAddr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", r.VaultToken)
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return "", fmt.Errorf("secrets: vault returned %s for %s", res.Status, path)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("secrets: reading vault response for %s: %w", path, err)
+	}
+
+	// KV version 2 nests the secret under data.data, next to its metadata.
+	fields := body.Data
+	if nested, ok := fields["data"].(map[string]any); ok {
+		if _, hasMeta := fields["metadata"]; hasMeta {
+			fields = nested
+		}
+	}
+
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secrets: vault secret %s has no string field %q", path, field)
+	}
+	return value, nil
+}
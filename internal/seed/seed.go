@@ -0,0 +1,64 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"snippety/internal/models"
+	"strings"
+	"time"
+)
+
+var (
+	adjectives = []string{"Quick", "Tiny", "Handy", "Minimal", "Reusable", "Safer", "Lazy", "Concurrent", "Buffered", "Generic"}
+	subjects   = []string{"HTTP client", "retry loop", "SQL query", "config loader", "worker pool", "rate limiter", "CSV parser", "middleware", "shell alias", "regex"}
+	haikuLines = [][]string{
+		{"An old silent pond", "Over the wintry", "The light of a candle", "First autumn morning"},
+		{"A frog jumps into the pond", "Forest, winds howl in rage", "Is transferred to another candle", "The mirror I stare into"},
+		{"Splash! Silence again.", "With no leaves to blow.", "Spring twilight.", "Shows my father's face."},
+	}
+	codeSnippets = []string{
+		"for i := 0; i < n; i++ {\n\tfmt.Println(i)\n}",
+		"SELECT id, title FROM snippets\nWHERE expires > UTC_TIMESTAMP()\nORDER BY id DESC LIMIT 10;",
+		"alias gs='git status -sb'\nalias gl='git log --oneline --graph'",
+		"ctx, cancel := context.WithTimeout(ctx, 5*time.Second)\ndefer cancel()",
+		"^[a-z0-9._%+-]+@[a-z0-9.-]+\\.[a-z]{2,}$",
+		"def retry(fn, attempts=3):\n    for i in range(attempts):\n        try:\n            return fn()\n        except Exception:\n            time.sleep(2 ** i)",
+	}
+	expiries = []int{1, 7, 365}
+)
+
+// Generate n fake snippets with creation times spread over the last
+// 30 days. IDs are left zero for the database to assign.
+func Generate(n int, r *rand.Rand) []models.Snippet {
+	now := time.Now().UTC().Truncate(time.Second)
+	snippets := make([]models.Snippet, n)
+
+	for i := range snippets {
+		created := now.Add(-time.Duration(r.Int64N(int64(30 * 24 * time.Hour)))).Truncate(time.Second)
+		days := expiries[r.IntN(len(expiries))]
+
+		snippets[i] = models.Snippet{
+			Title:   fmt.Sprintf("%s %s", pick(r, adjectives), pick(r, subjects)),
+			Content: content(r),
+			Created: created,
+			Expires: created.AddDate(0, 0, days),
+		}
+	}
+
+	return snippets
+}
+
+func content(r *rand.Rand) string {
+	if r.IntN(3) == 0 {
+		lines := make([]string, len(haikuLines))
+		for i, choices := range haikuLines {
+			lines[i] = pick(r, choices)
+		}
+		return strings.Join(lines, "\n")
+	}
+	return pick(r, codeSnippets)
+}
+
+func pick(r *rand.Rand, choices []string) string {
+	return choices[r.IntN(len(choices))]
+}
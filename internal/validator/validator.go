@@ -0,0 +1,81 @@
+// Package validator collects per-field validation errors for forms and API
+// requests.
+package validator
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validator records the first error message for each field. Embed it in a
+// form struct so templates can reach FieldErrors alongside the values.
+type Validator struct {
+	FieldErrors map[string]string
+}
+
+// Valid reports whether no errors have been recorded.
+func (v *Validator) Valid() bool {
+	return len(v.FieldErrors) == 0
+}
+
+// AddFieldError records message for key unless the field already has one.
+func (v *Validator) AddFieldError(key, message string) {
+	if v.FieldErrors == nil {
+		v.FieldErrors = map[string]string{}
+	}
+	if _, exists := v.FieldErrors[key]; !exists {
+		v.FieldErrors[key] = message
+	}
+}
+
+// CheckField records message for key if ok is false.
+func (v *Validator) CheckField(ok bool, key, message string) {
+	if !ok {
+		v.AddFieldError(key, message)
+	}
+}
+
+// NotBlank reports whether value contains something besides whitespace.
+func NotBlank(value string) bool {
+	return strings.TrimSpace(value) != ""
+}
+
+// MaxChars reports whether value has at most n characters.
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+// MaxBytes reports whether value is at most n bytes long.
+func MaxBytes(value string, n int) bool {
+	return len(value) <= n
+}
+
+// PermittedValue reports whether value is one of permitted.
+func PermittedValue[T comparable](value T, permitted ...T) bool {
+	return slices.Contains(permitted, value)
+}
+
+// ValidUTF8 reports whether value is valid UTF-8.
+func ValidUTF8(value string) bool {
+	return utf8.ValidString(value)
+}
+
+// NotBinary reports whether value looks like text: it contains no NUL
+// bytes and at most 1 in 10 characters are control characters other than
+// ordinary whitespace.
+func NotBinary(value string) bool {
+	if strings.IndexByte(value, 0) >= 0 {
+		return false
+	}
+
+	var total, control int
+	for _, r := range value {
+		total++
+		if unicode.IsControl(r) && !strings.ContainsRune("\t\n\r\f", r) {
+			control++
+		}
+	}
+	return control*10 <= total
+}
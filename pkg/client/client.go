@@ -0,0 +1,223 @@
+// Package client is a Go client for the Snippety JSON API.
+//
+//	c := &client.Client{BaseURL: "https://snippety.example"}
+//	s, err := c.Get(ctx, 42)
+//
+// Requests that the server refused because it was busy (429 and 503) are
+// retried after the delay it asks for, and GETs are also retried after
+// network errors. Errors from the API are returned as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API at BaseURL. The zero value of every other field is
+// usable; set AdminUser and AdminPassword for admin-only calls such as
+// Update, or Token for QuickSave.
+type Client struct {
+	// Root of the site, such as https://snippety.example.
+	BaseURL    string
+	HTTPClient *http.Client
+
+	AdminUser     string
+	AdminPassword string
+	// A quick save token from the server's -quick-save-tokens.
+	Token string
+
+	// Extra attempts after the first. Zero means DefaultRetries; use a
+	// negative number to disable retries.
+	Retries int
+}
+
+const (
+	DefaultRetries = 3
+	// Waits between attempts double from this when the server doesn't
+	// say how long to wait.
+	retryBackoff = 500 * time.Millisecond
+	// Longest Retry-After honoured, so a long outage fails fast instead
+	// of blocking the caller.
+	maxRetryWait = 30 * time.Second
+)
+
+// Error is an error response from the API.
+type Error struct {
+	Status  int
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields"`
+	// The resource as it is now, sent with CodeEditConflict.
+	Current *Snippet `json:"current"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("snippety: %s (%d %s)", e.Message, e.Status, e.Code)
+	for field, problem := range e.Fields {
+		msg += fmt.Sprintf("; %s %s", field, problem)
+	}
+	return msg
+}
+
+// Error codes sent by the API. See cmd/web/api.go for when each is used.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeEditConflict     = "edit_conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "too_large"
+	CodeValidationFailed = "validation_failed"
+	CodeUnformattable    = "unformattable"
+	CodeRateLimited      = "rate_limited"
+	CodeUnavailable      = "unavailable"
+	CodeReadOnly         = "read_only"
+	CodeInternal         = "internal_error"
+)
+
+// IsNotFound reports whether err is a not_found error from the API.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == CodeNotFound
+}
+
+// IsEditConflict reports whether err is an edit_conflict error, meaning
+// the snippet changed since the version given to Update.
+func IsEditConflict(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == CodeEditConflict
+}
+
+// Send a request and decode the JSON response into dst, which may be nil.
+// body is sent as JSON unless it's a []byte, which is sent as plain text.
+func (c *Client) do(ctx context.Context, method, path string, body any, dst any) error {
+	var (
+		payload     []byte
+		contentType string
+		err         error
+	)
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		payload, contentType = b, "text/plain; charset=utf-8"
+	default:
+		payload, err = json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	retries := c.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		switch {
+		case c.AdminPassword != "":
+			req.SetBasicAuth(c.AdminUser, c.AdminPassword)
+		case c.Token != "":
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+
+		res, err := c.httpClient().Do(req)
+		if err != nil {
+			// The request may have been processed, so only reads are
+			// safe to send again.
+			if method != http.MethodGet || attempt >= retries || ctx.Err() != nil {
+				return err
+			}
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if (res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable) && attempt < retries {
+			wait, ok := retryAfter(res)
+			res.Body.Close()
+			if !ok {
+				wait = backoff(attempt)
+			}
+			if wait > maxRetryWait {
+				return &Error{Status: res.StatusCode, Code: CodeUnavailable, Message: "the service asked to retry after " + wait.String()}
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return decode(res, dst)
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Read the response, returning an *Error for error statuses.
+func decode(res *http.Response, dst any) error {
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		var envelope struct {
+			Error *Error `json:"error"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		if json.Unmarshal(b, &envelope) != nil || envelope.Error == nil {
+			return &Error{Status: res.StatusCode, Code: CodeInternal, Message: strings.TrimSpace(string(b))}
+		}
+		envelope.Error.Status = res.StatusCode
+		return envelope.Error
+	}
+
+	if dst == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(dst)
+}
+
+func backoff(attempt int) time.Duration {
+	return retryBackoff << attempt
+}
+
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Snippet as returned by the API. Listings leave Content empty.
+type Snippet struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language"`
+	Excerpt  string    `json:"excerpt"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	// Seconds until Expires by the server's clock when it responded.
+	ExpiresIn int64     `json:"expires_in"`
+	PublishAt time.Time `json:"publish_at"`
+	// Pass this to Update so changes made since aren't overwritten.
+	Version int       `json:"version"`
+	Updated time.Time `json:"updated"`
+	// Key/value data attached when the snippet was created or updated.
+	Metadata map[string]string `json:"metadata"`
+	Stats    struct {
+		Lines int `json:"lines"`
+		Words int `json:"words"`
+		Bytes int `json:"bytes"`
+	} `json:"stats"`
+}
+
+// NeverExpires, given as NewSnippet.Expires or SnippetUpdate.Expires,
+// keeps a snippet forever on servers run with -allow-never-expire.
+const NeverExpires = -1
+
+// NewSnippet is the input to Create.
+type NewSnippet struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Language string `json:"language,omitempty"`
+	// Up to 16 keys of letters, digits, underscores or hyphens, 2KB in all.
+	// Snippets can be searched by key with the meta:<key> operator.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Days until the snippet expires, from the choices the server offers.
+	// Leave zero for the server's default, or use NeverExpires where the
+	// server allows it.
+	Expires int `json:"expires,omitempty"`
+	// Leave zero to publish immediately.
+	PublishAt time.Time `json:"publish_at"`
+}
+
+// SnippetUpdate is the input to Update. Nil fields are left as they are.
+type SnippetUpdate struct {
+	Title    *string `json:"title,omitempty"`
+	Content  *string `json:"content,omitempty"`
+	Language *string `json:"language,omitempty"`
+	// Replaces all of the metadata; an empty map removes it.
+	Metadata *map[string]string `json:"metadata,omitempty"`
+	// Days from now until the snippet expires.
+	Expires *int `json:"expires,omitempty"`
+}
+
+// ListOptions select a page of the listing. The zero value is the first
+// page of the newest snippets.
+type ListOptions struct {
+	Limit int
+	// "newest", "oldest", "title", "expiring", or "lines", "words" or
+	// "bytes" for the largest first.
+	Sort string
+	// Id to continue after, from a previous Page.NextCursor.
+	Cursor int
+	Offset int
+}
+
+// Page is one page of a listing.
+type Page struct {
+	Snippets []Snippet `json:"snippets"`
+	// Pass as ListOptions.Cursor to get the next page. Zero means this is
+	// the last page.
+	NextCursor int `json:"next_cursor"`
+	Metadata   struct {
+		TotalRecords int `json:"total_records"`
+		PageSize     int `json:"page_size"`
+		CurrentPage  int `json:"current_page"`
+		LastPage     int `json:"last_page"`
+	} `json:"metadata"`
+}
+
+// Get fetches a snippet with its content.
+func (c *Client) Get(ctx context.Context, id int) (Snippet, error) {
+	var out struct {
+		Snippet Snippet `json:"snippet"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/snippets/%d", id), nil, &out)
+	return out.Snippet, err
+}
+
+// List fetches one page of live, published snippets.
+func (c *Client) List(ctx context.Context, opts ListOptions) (Page, error) {
+	q := url.Values{}
+	for name, n := range map[string]int{"limit": opts.Limit, "cursor": opts.Cursor, "offset": opts.Offset} {
+		if n > 0 {
+			q.Set(name, strconv.Itoa(n))
+		}
+	}
+	if opts.Sort != "" {
+		q.Set("sort", opts.Sort)
+	}
+
+	var page Page
+	err := c.do(ctx, http.MethodGet, "/api/v1/snippets?"+q.Encode(), nil, &page)
+	return page, err
+}
+
+// All iterates over every snippet in the listing, fetching pages as it
+// goes. Iteration stops at the first error, which is yielded with a zero
+// Snippet. Only the newest and oldest sorts can be paged this way.
+func (c *Client) All(ctx context.Context, opts ListOptions) iter.Seq2[Snippet, error] {
+	return func(yield func(Snippet, error) bool) {
+		for {
+			page, err := c.List(ctx, opts)
+			if err != nil {
+				yield(Snippet{}, err)
+				return
+			}
+			for _, s := range page.Snippets {
+				if !yield(s, nil) {
+					return
+				}
+			}
+			if page.NextCursor == 0 {
+				return
+			}
+			opts.Cursor, opts.Offset = page.NextCursor, 0
+		}
+	}
+}
+
+// Changes is the result of Sync.
+type Changes struct {
+	// Snippets created or changed since, with their content.
+	Snippets []Snippet `json:"snippets"`
+	// Snippets that have gone since, which should be dropped.
+	Deleted []struct {
+		ID        int       `json:"id"`
+		DeletedAt time.Time `json:"deleted_at"`
+	} `json:"deleted"`
+	// Pass to the next Sync.
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// Sync fetches what changed since the SyncedAt of an earlier Sync. Start
+// from a full listing with All and the time just before it was taken.
+// The server sends changes a page at a time; Sync fetches them all.
+func (c *Client) Sync(ctx context.Context, since time.Time) (Changes, error) {
+	var out Changes
+	path := "/api/v1/snippets?updated_since=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
+
+	for p := path; ; {
+		var page struct {
+			Changes
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := c.do(ctx, http.MethodGet, p, nil, &page); err != nil {
+			return Changes{}, err
+		}
+
+		// Every page is of the same sync, so a snippet is only ever on
+		// one of them.
+		out.Snippets = append(out.Snippets, page.Snippets...)
+		out.Deleted = append(out.Deleted, page.Deleted...)
+		out.SyncedAt = page.SyncedAt
+
+		if page.NextCursor == "" {
+			return out, nil
+		}
+		p = path + "&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+}
+
+// Search returns up to 50 snippets matching a query in the search page's
+// syntax, such as `"worker pool" after:2026-01-01`.
+func (c *Client) Search(ctx context.Context, query string) ([]Snippet, error) {
+	var page Page
+	err := c.do(ctx, http.MethodGet, "/api/v1/snippets?q="+url.QueryEscape(query), nil, &page)
+	return page.Snippets, err
+}
+
+// Suggestion is a title offered by Suggest.
+type Suggestion struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Suggest returns titles starting with prefix, for search-as-you-type.
+func (c *Client) Suggest(ctx context.Context, prefix string) ([]Suggestion, error) {
+	var out struct {
+		Suggestions []Suggestion `json:"suggestions"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/search/suggest?q="+url.QueryEscape(prefix), nil, &out)
+	return out.Suggestions, err
+}
+
+// Create adds a snippet and returns it as stored.
+func (c *Client) Create(ctx context.Context, s NewSnippet) (Snippet, error) {
+	var out struct {
+		Snippet Snippet `json:"snippet"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/snippets", s, &out)
+	return out.Snippet, err
+}
+
+// Update changes some of a snippet's fields, as admin. version is the one
+// the caller last saw; if the snippet changed since, the error satisfies
+// IsEditConflict and its Current field holds the latest version.
+func (c *Client) Update(ctx context.Context, id, version int, u SnippetUpdate) (Snippet, error) {
+	body := struct {
+		SnippetUpdate
+		Version int `json:"version"`
+	}{u, version}
+
+	var out struct {
+		Snippet Snippet `json:"snippet"`
+	}
+	err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/v1/snippets/%d", id), body, &out)
+	return out.Snippet, err
+}
+
+// QuickSaveOptions are the optional parts of a QuickSave.
+type QuickSaveOptions struct {
+	// Defaults to the content's first non-blank line.
+	Title    string
+	Language string
+	// Days until expiry; zero means the server's -default-expiry.
+	Expires  int
+	Metadata map[string]string
+}
+
+// QuickSave pastes content using Token and returns the new snippet's page
+// URL.
+func (c *Client) QuickSave(ctx context.Context, content string, opts QuickSaveOptions) (string, error) {
+	q := url.Values{}
+	if opts.Title != "" {
+		q.Set("title", opts.Title)
+	}
+	if opts.Language != "" {
+		q.Set("language", opts.Language)
+	}
+	if opts.Expires != 0 {
+		q.Set("expires", strconv.Itoa(opts.Expires))
+	}
+	for k, v := range opts.Metadata {
+		q.Set("meta."+k, v)
+	}
+
+	var out struct {
+		URL string `json:"url"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/quick?"+q.Encode(), []byte(content), &out)
+	return out.URL, err
+}
+
+// LanguageCount is the number of live snippets in a language.
+type LanguageCount struct {
+	// Empty for plain text.
+	Language string `json:"language"`
+	Count    int    `json:"count"`
+}
+
+// LanguageStats returns the number of live snippets and how many there
+// are per language, most used first.
+func (c *Client) LanguageStats(ctx context.Context) (total int, languages []LanguageCount, err error) {
+	var out struct {
+		Total     int             `json:"total"`
+		Languages []LanguageCount `json:"languages"`
+	}
+	err = c.do(ctx, http.MethodGet, "/api/v1/stats/languages", nil, &out)
+	return out.Total, out.Languages, err
+}
+
+// Version returns the server's build information.
+func (c *Client) Version(ctx context.Context) (map[string]any, error) {
+	var out map[string]any
+	err := c.do(ctx, http.MethodGet, "/api/v1/version", nil, &out)
+	return out, err
+}
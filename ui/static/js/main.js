@@ -5,4 +5,38 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
+}
+
+// Clicking a header in a .sortable table sorts its rows by that column,
+// using each cell's data-sort value when present. Clicking again reverses.
+var sortableTables = document.querySelectorAll("table.sortable");
+for (var t = 0; t < sortableTables.length; t++) {
+	(function (table) {
+		var headers = table.querySelectorAll("th");
+		for (var h = 0; h < headers.length; h++) {
+			(function (index, header) {
+				header.style.cursor = "pointer";
+				header.addEventListener("click", function () {
+					var rows = Array.prototype.slice.call(table.querySelectorAll("tr")).slice(1);
+					var desc = header.getAttribute("data-dir") !== "desc";
+					header.setAttribute("data-dir", desc ? "desc" : "asc");
+
+					rows.sort(function (a, b) {
+						var x = sortValue(a.children[index]), y = sortValue(b.children[index]);
+						var cmp = (typeof x === "number" && typeof y === "number") ? x - y : String(x).localeCompare(String(y));
+						return desc ? -cmp : cmp;
+					});
+					for (var i = 0; i < rows.length; i++) {
+						rows[i].parentNode.appendChild(rows[i]);
+					}
+				});
+			})(h, headers[h]);
+		}
+	})(sortableTables[t]);
+}
+
+function sortValue(cell) {
+	var v = cell.hasAttribute("data-sort") ? cell.getAttribute("data-sort") : cell.textContent.trim();
+	var n = Number(v);
+	return v !== "" && !isNaN(n) ? n : v;
 }
\ No newline at end of file